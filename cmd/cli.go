@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -35,7 +36,7 @@ func main() {
 	fmt.Println("-----------------")
 
 	for {
-		fmt.Println("\nCommands: balance | send | register | buy | sell | history | exit")
+		fmt.Println("\nCommands: balance | send | register | reveal | renew | release | setip | records | buy | sell | cancel | offer | offers | acceptoffer | bid | revealbid | settle | give | accept | lock | unlock | delegate | revoke | primary | history | namehistory | zone | exit")
 		fmt.Print("> ")
 		cmd, _ := reader.ReadString('\n')
 		cmd = strings.TrimSpace(cmd)
@@ -47,12 +48,54 @@ func main() {
 			send(wallet, reader)
 		case "register":
 			registerDomain(wallet, reader)
+		case "reveal":
+			revealDomain(wallet, reader)
+		case "renew":
+			renewDomain(wallet, reader)
+		case "release":
+			releaseDomain(wallet, reader)
+		case "setip":
+			setIP(wallet, reader)
+		case "records":
+			setRecords(wallet, reader)
 		case "buy":
 			buyDomain(wallet, reader)
 		case "sell":
 			sellDomain(wallet, reader)
+		case "cancel":
+			cancelListing(wallet, reader)
+		case "offer":
+			makeOffer(wallet, reader)
+		case "offers":
+			showOffers(reader)
+		case "acceptoffer":
+			acceptOffer(wallet, reader)
+		case "bid":
+			placeBid(wallet, reader)
+		case "revealbid":
+			revealBid(wallet, reader)
+		case "settle":
+			settleAuction(wallet, reader)
+		case "give":
+			giveDomain(wallet, reader)
+		case "accept":
+			acceptDomain(wallet, reader)
+		case "lock":
+			lockDomain(wallet, reader)
+		case "unlock":
+			unlockDomain(wallet, reader)
+		case "delegate":
+			delegateDomain(wallet, reader)
+		case "revoke":
+			revokeDomain(wallet, reader)
+		case "primary":
+			setPrimary(wallet, reader)
 		case "history":
 			showHistory(wallet.Address)
+		case "namehistory":
+			showNameHistory(reader)
+		case "zone":
+			exportZone(reader)
 		case "exit":
 			fmt.Println("Bye!")
 			return
@@ -75,10 +118,25 @@ func balance(addr string) {
 }
 
 func send(wallet *internal.Wallet, reader *bufio.Reader) {
-	fmt.Print("Send to address: ")
+	fmt.Print("Send to address or name: ")
 	to, _ := reader.ReadString('\n')
 	to = strings.TrimSpace(to)
 
+	if !internal.IsAddress(to) {
+		to = canonicalName(to)
+		owner, err := resolveOwner(to)
+		if err != nil {
+			fmt.Println("Cannot resolve recipient:", err)
+			return
+		}
+		fmt.Printf("%s is owned by %s. Continue? (y/N): ", to, owner)
+		confirm, _ := reader.ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(confirm), "y") {
+			fmt.Println("Cancelled")
+			return
+		}
+	}
+
 	fmt.Print("Amount to send: ")
 	amtStr, _ := reader.ReadString('\n')
 	amtStr = strings.TrimSpace(amtStr)
@@ -105,7 +163,7 @@ func send(wallet *internal.Wallet, reader *bufio.Reader) {
 		Fee:   fee,
 	}
 
-	if err := internal.SignTransaction(&tx, wallet.PrivateKey); err != nil {
+	if err := signTx(&tx, wallet); err != nil {
 		fmt.Println("Failed to sign tx:", err)
 		return
 	}
@@ -113,30 +171,244 @@ func send(wallet *internal.Wallet, reader *bufio.Reader) {
 	sendTx(tx)
 }
 
+// canonicalName normalizes a name typed by the user. Names that cannot be
+// normalized are passed on as typed, for the node to reject.
+func canonicalName(name string) string {
+	if canonical, err := internal.NormalizeName(name); err == nil {
+		return canonical
+	}
+	return strings.TrimSpace(name)
+}
+
+// resolveOwner returns the current owner of an active name.
+func resolveOwner(name string) (string, error) {
+	resp, err := http.Get(nodeURL + "/names/" + name)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("name %q is not registered", name)
+	}
+
+	var info struct {
+		Owner  string `json:"owner"`
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", err
+	}
+	if info.Status != internal.NameActive {
+		return "", fmt.Errorf("name %q is in its %s period", name, info.Status)
+	}
+	return info.Owner, nil
+}
+
 func registerDomain(wallet *internal.Wallet, reader *bufio.Reader) {
 	fmt.Print("Domain name to register: ")
 	name, _ := reader.ReadString('\n')
-	name = strings.TrimSpace(name)
-
-	fmt.Print("Price: ")
-	priceStr, _ := reader.ReadString('\n')
-	priceStr = strings.TrimSpace(priceStr)
-	price, err := strconv.ParseFloat(priceStr, 64)
+	name, err := internal.NormalizeName(name)
 	if err != nil {
-		fmt.Println("Invalid price")
+		fmt.Println("Invalid name:", err)
 		return
 	}
+	fmt.Printf("Registering %s costs %.8f\n", name, internal.NamePrice(name))
+
+	saltBytes := make([]byte, 16)
+	if _, err := rand.Read(saltBytes); err != nil {
+		fmt.Println("Failed to generate salt:", err)
+		return
+	}
+	salt := hex.EncodeToString(saltBytes)
+
+	tx := internal.Transaction{
+		Type:       internal.TxCommit,
+		From:       wallet.Address,
+		Fee:        1,
+		Commitment: internal.Commitment(name, salt, wallet.Address),
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	if sendTx(tx) {
+		fmt.Printf("Salt: %s\n", salt)
+		fmt.Printf("Run 'reveal' with this salt once the commitment is mined, within %d blocks.\n", internal.MaxCommitAge)
+	}
+}
+
+func revealDomain(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name to register: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	fmt.Print("Salt: ")
+	salt, _ := reader.ReadString('\n')
+	salt = strings.TrimSpace(salt)
+
+	fmt.Printf("Hold the %.8f price as a deposit, refunded on release, expiry or transfer? (y/N): ", internal.NamePrice(name))
+	deposit, _ := reader.ReadString('\n')
+	to := "nebula"
+	if strings.EqualFold(strings.TrimSpace(deposit), "y") {
+		to = internal.EscrowAddress
+	}
 
 	tx := internal.Transaction{
 		Type:  internal.TxRegister,
 		From:  wallet.Address,
+		To:    to,
+		Name:  name,
+		Price: internal.NamePrice(name),
+		Fee:   1,
+		Salt:  salt,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func renewDomain(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name to renew: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	tx := internal.Transaction{
+		Type:  internal.TxRenew,
+		From:  wallet.Address,
 		To:    "nebula",
 		Name:  name,
-		Price: price,
+		Price: internal.RenewalFee,
 		Fee:   1,
 	}
 
-	if err := internal.SignTransaction(&tx, wallet.PrivateKey); err != nil {
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func releaseDomain(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name to release: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	tx := internal.Transaction{
+		Type: internal.TxRelease,
+		From: wallet.Address,
+		Name: name,
+		Fee:  1,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func setIP(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	fmt.Print("IP address: ")
+	ip, _ := reader.ReadString('\n')
+	ip = strings.TrimSpace(ip)
+
+	tx := internal.Transaction{
+		Type:    internal.TxSetIP,
+		From:    wallet.Address,
+		Name:    name,
+		Fee:     1,
+		Payload: map[string]string{"ip": ip},
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func setRecords(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	var records []internal.Record
+	for {
+		fmt.Print("Record type (A, AAAA, CNAME, TXT, MX, SRV; empty to finish): ")
+		rtype, _ := reader.ReadString('\n')
+		rtype = strings.ToUpper(strings.TrimSpace(rtype))
+		if rtype == "" {
+			break
+		}
+
+		record := internal.Record{Type: rtype}
+		fmt.Print("Value: ")
+		record.Value, _ = reader.ReadString('\n')
+		record.Value = strings.TrimSpace(record.Value)
+
+		ttl, err := readUint(reader, "TTL: ", 32)
+		if err != nil {
+			fmt.Println("Invalid TTL")
+			return
+		}
+		record.TTL = uint32(ttl)
+
+		if rtype == internal.RecordMX || rtype == internal.RecordSRV {
+			priority, err := readUint(reader, "Priority: ", 16)
+			if err != nil {
+				fmt.Println("Invalid priority")
+				return
+			}
+			record.Priority = uint16(priority)
+		}
+		if rtype == internal.RecordSRV {
+			weight, err := readUint(reader, "Weight: ", 16)
+			if err != nil {
+				fmt.Println("Invalid weight")
+				return
+			}
+			port, err := readUint(reader, "Port: ", 16)
+			if err != nil {
+				fmt.Println("Invalid port")
+				return
+			}
+			record.Weight, record.Port = uint16(weight), uint16(port)
+		}
+
+		if err := record.Validate(); err != nil {
+			fmt.Println("Invalid record:", err)
+			return
+		}
+		records = append(records, record)
+	}
+
+	if err := internal.ValidateRecords(records); err != nil {
+		fmt.Println("Invalid records:", err)
+		return
+	}
+
+	tx := internal.Transaction{
+		Type:    internal.TxSetRecords,
+		From:    wallet.Address,
+		Name:    name,
+		Fee:     1,
+		Records: records,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
 		fmt.Println("Failed to sign tx:", err)
 		return
 	}
@@ -144,10 +416,16 @@ func registerDomain(wallet *internal.Wallet, reader *bufio.Reader) {
 	sendTx(tx)
 }
 
+func readUint(reader *bufio.Reader, prompt string, bits int) (uint64, error) {
+	fmt.Print(prompt)
+	str, _ := reader.ReadString('\n')
+	return strconv.ParseUint(strings.TrimSpace(str), 10, bits)
+}
+
 func buyDomain(wallet *internal.Wallet, reader *bufio.Reader) {
 	fmt.Print("Domain name to buy: ")
 	name, _ := reader.ReadString('\n')
-	name = strings.TrimSpace(name)
+	name = canonicalName(name)
 
 	fmt.Print("Price: ")
 	priceStr, _ := reader.ReadString('\n')
@@ -166,7 +444,7 @@ func buyDomain(wallet *internal.Wallet, reader *bufio.Reader) {
 		Fee:   1,
 	}
 
-	if err := internal.SignTransaction(&tx, wallet.PrivateKey); err != nil {
+	if err := signTx(&tx, wallet); err != nil {
 		fmt.Println("Failed to sign tx:", err)
 		return
 	}
@@ -177,7 +455,7 @@ func buyDomain(wallet *internal.Wallet, reader *bufio.Reader) {
 func sellDomain(wallet *internal.Wallet, reader *bufio.Reader) {
 	fmt.Print("Domain name to sell: ")
 	name, _ := reader.ReadString('\n')
-	name = strings.TrimSpace(name)
+	name = canonicalName(name)
 
 	fmt.Print("Price: ")
 	priceStr, _ := reader.ReadString('\n')
@@ -188,15 +466,387 @@ func sellDomain(wallet *internal.Wallet, reader *bufio.Reader) {
 		return
 	}
 
+	fmt.Print("Listing expiry block (empty for none): ")
+	expiryStr, _ := reader.ReadString('\n')
+	expiryStr = strings.TrimSpace(expiryStr)
+	expiry := 0
+	if expiryStr != "" {
+		expiry, err = strconv.Atoi(expiryStr)
+		if err != nil {
+			fmt.Println("Invalid expiry")
+			return
+		}
+	}
+
+	tx := internal.Transaction{
+		Type:      internal.TxSell,
+		From:      wallet.Address,
+		Name:      name,
+		Price:     price,
+		Fee:       1,
+		ExpiresAt: expiry,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func makeOffer(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name to make an offer on: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	fmt.Print("Amount to offer: ")
+	amtStr, _ := reader.ReadString('\n')
+	amt, err := strconv.ParseFloat(strings.TrimSpace(amtStr), 64)
+	if err != nil {
+		fmt.Println("Invalid amount")
+		return
+	}
+
+	fmt.Print("Offer expiry block: ")
+	expiryStr, _ := reader.ReadString('\n')
+	expiry, err := strconv.Atoi(strings.TrimSpace(expiryStr))
+	if err != nil {
+		fmt.Println("Invalid expiry")
+		return
+	}
+
+	tx := internal.Transaction{
+		Type:      internal.TxOffer,
+		From:      wallet.Address,
+		To:        internal.EscrowAddress,
+		Name:      name,
+		Price:     amt,
+		Fee:       1,
+		ExpiresAt: expiry,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	if sendTx(tx) {
+		fmt.Printf("The amount stays in escrow until the offer is accepted or lapses at block %d.\n", expiry)
+	}
+}
+
+func showOffers(reader *bufio.Reader) {
+	fmt.Print("Domain name: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	resp, err := http.Get(nodeURL + "/names/" + name + "/offers")
+	if err != nil {
+		fmt.Println("Error fetching offers:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var offers []internal.Offer
+	if err := json.NewDecoder(resp.Body).Decode(&offers); err != nil {
+		fmt.Println("Error decoding offers:", err)
+		return
+	}
+
+	fmt.Printf("Open offers on %s:\n", name)
+	for _, o := range offers {
+		fmt.Printf("Buyer: %s | Amount: %.8f | Expires: block %d\n", o.Buyer, o.Amount, o.ExpiresAt)
+	}
+}
+
+func acceptOffer(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	fmt.Print("Buyer address: ")
+	buyer, _ := reader.ReadString('\n')
+	buyer = strings.TrimSpace(buyer)
+	if !internal.IsAddress(buyer) {
+		fmt.Println("Invalid address")
+		return
+	}
+
+	tx := internal.Transaction{
+		Type: internal.TxAcceptOffer,
+		From: wallet.Address,
+		To:   buyer,
+		Name: name,
+		Fee:  1,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func cancelListing(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name to delist: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	tx := internal.Transaction{
+		Type: internal.TxCancelListing,
+		From: wallet.Address,
+		Name: name,
+		Fee:  1,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func placeBid(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name to bid on: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	fmt.Print("Bid: ")
+	bidStr, _ := reader.ReadString('\n')
+	bid, err := strconv.ParseFloat(strings.TrimSpace(bidStr), 64)
+	if err != nil {
+		fmt.Println("Invalid bid")
+		return
+	}
+
+	fmt.Print("Deposit (at least the bid; hides its size): ")
+	depositStr, _ := reader.ReadString('\n')
+	deposit, err := strconv.ParseFloat(strings.TrimSpace(depositStr), 64)
+	if err != nil || deposit < bid {
+		fmt.Println("Invalid deposit")
+		return
+	}
+
+	saltBytes := make([]byte, 16)
+	if _, err := rand.Read(saltBytes); err != nil {
+		fmt.Println("Failed to generate salt:", err)
+		return
+	}
+	salt := hex.EncodeToString(saltBytes)
+
 	tx := internal.Transaction{
-		Type:  internal.TxSell,
+		Type:       internal.TxBid,
+		From:       wallet.Address,
+		To:         internal.EscrowAddress,
+		Name:       name,
+		Price:      deposit,
+		Fee:        1,
+		Commitment: internal.BidCommitment(name, bid, salt, wallet.Address),
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	if sendTx(tx) {
+		fmt.Printf("Salt: %s\n", salt)
+		fmt.Println("Run 'revealbid' with this salt once bidding closes, or the deposit is forfeited.")
+	}
+}
+
+func revealBid(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	fmt.Print("Bid: ")
+	bidStr, _ := reader.ReadString('\n')
+	bid, err := strconv.ParseFloat(strings.TrimSpace(bidStr), 64)
+	if err != nil {
+		fmt.Println("Invalid bid")
+		return
+	}
+
+	fmt.Print("Salt: ")
+	salt, _ := reader.ReadString('\n')
+	salt = strings.TrimSpace(salt)
+
+	tx := internal.Transaction{
+		Type:  internal.TxRevealBid,
 		From:  wallet.Address,
 		Name:  name,
-		Price: price,
+		Price: bid,
 		Fee:   1,
+		Salt:  salt,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func settleAuction(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	tx := internal.Transaction{
+		Type: internal.TxSettleAuction,
+		From: wallet.Address,
+		Name: name,
+		Fee:  1,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func giveDomain(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name to transfer: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	fmt.Print("Recipient address: ")
+	to, _ := reader.ReadString('\n')
+	to = strings.TrimSpace(to)
+	if !internal.IsAddress(to) {
+		fmt.Println("Invalid address")
+		return
+	}
+
+	fmt.Printf("Blocks the recipient has to accept (0 transfers at once, max %d): ", internal.MaxAcceptBlocks)
+	blocksStr, _ := reader.ReadString('\n')
+	blocks, err := strconv.Atoi(strings.TrimSpace(blocksStr))
+	if err != nil || blocks < 0 || blocks > internal.MaxAcceptBlocks {
+		fmt.Println("Invalid number of blocks")
+		return
+	}
+
+	tx := internal.Transaction{
+		Type:   internal.TxTransferName,
+		From:   wallet.Address,
+		To:     to,
+		Name:   name,
+		Fee:    1,
+		Blocks: blocks,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func acceptDomain(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name to accept: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	tx := internal.Transaction{
+		Type: internal.TxAcceptName,
+		From: wallet.Address,
+		Name: name,
+		Fee:  1,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func lockDomain(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name to lock: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	fmt.Printf("Blocks to lock it for (max %d): ", internal.MaxLockBlocks)
+	blocksStr, _ := reader.ReadString('\n')
+	blocks, err := strconv.Atoi(strings.TrimSpace(blocksStr))
+	if err != nil || blocks <= 0 || blocks > internal.MaxLockBlocks {
+		fmt.Println("Invalid number of blocks")
+		return
+	}
+
+	tx := internal.Transaction{
+		Type:   internal.TxLock,
+		From:   wallet.Address,
+		Name:   name,
+		Fee:    1,
+		Blocks: blocks,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func unlockDomain(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Domain name to unlock: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	tx := internal.Transaction{
+		Type: internal.TxUnlock,
+		From: wallet.Address,
+		Name: name,
+		Fee:  1,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	if sendTx(tx) {
+		fmt.Printf("The lock lifts %d blocks after this is mined.\n", internal.UnlockDelayBlocks)
+	}
+}
+
+func delegateDomain(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Subdomain to delegate (e.g. api.example): ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	fmt.Print("Sub-owner address: ")
+	to, _ := reader.ReadString('\n')
+	to = strings.TrimSpace(to)
+	if !internal.IsAddress(to) {
+		fmt.Println("Invalid address")
+		return
 	}
 
-	if err := internal.SignTransaction(&tx, wallet.PrivateKey); err != nil {
+	fmt.Print("Allow revoking it later? (y/N): ")
+	revocable, _ := reader.ReadString('\n')
+
+	tx := internal.Transaction{
+		Type:      internal.TxDelegate,
+		From:      wallet.Address,
+		To:        to,
+		Name:      name,
+		Fee:       1,
+		Revocable: strings.EqualFold(strings.TrimSpace(revocable), "y"),
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
 		fmt.Println("Failed to sign tx:", err)
 		return
 	}
@@ -204,26 +854,106 @@ func sellDomain(wallet *internal.Wallet, reader *bufio.Reader) {
 	sendTx(tx)
 }
 
-func sendTx(tx internal.Transaction) {
+func revokeDomain(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Subdomain to revoke: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	tx := internal.Transaction{
+		Type: internal.TxRevoke,
+		From: wallet.Address,
+		Name: name,
+		Fee:  1,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+func setPrimary(wallet *internal.Wallet, reader *bufio.Reader) {
+	fmt.Print("Primary name (empty to clear): ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	tx := internal.Transaction{
+		Type: internal.TxSetPrimary,
+		From: wallet.Address,
+		Name: name,
+		Fee:  1,
+	}
+
+	if err := signTx(&tx, wallet); err != nil {
+		fmt.Println("Failed to sign tx:", err)
+		return
+	}
+
+	sendTx(tx)
+}
+
+// signTx sets the chain ID of the node and the next nonce of the wallet
+// on tx and signs it.
+func signTx(tx *internal.Transaction, wallet *internal.Wallet) error {
+	chainID, err := fetchText(nodeURL + "/chain")
+	if err != nil {
+		return fmt.Errorf("fetching chain id: %w", err)
+	}
+	nonce, err := fetchText(nodeURL + "/nonce?address=" + wallet.Address)
+	if err != nil {
+		return fmt.Errorf("fetching nonce: %w", err)
+	}
+
+	tx.ChainID = chainID
+	tx.Nonce, err = strconv.ParseUint(nonce, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid nonce %q", nonce)
+	}
+	return internal.SignTransaction(tx, wallet.PrivateKey)
+}
+
+// fetchText returns the plain-text body of a node endpoint.
+func fetchText(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", strings.TrimSpace(string(body)))
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func sendTx(tx internal.Transaction) bool {
 	data, err := json.Marshal(tx)
 	if err != nil {
 		fmt.Println("Failed to marshal tx:", err)
-		return
+		return false
 	}
 
 	resp, err := http.Post(nodeURL+"/tx", "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		fmt.Println("Failed to send tx:", err)
-		return
+		return false
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		fmt.Println("Tx rejected by node")
-		return
+		reason, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Tx rejected by node: %s\n", strings.TrimSpace(string(reason)))
+		return false
 	}
 
 	fmt.Println("Transaction sent successfully")
+	return true
 }
 
 func showHistory(addr string) {
@@ -240,13 +970,132 @@ func showHistory(addr string) {
 		return
 	}
 
-	fmt.Printf("Transaction history for %s:\n", addr)
+	names := map[string]string{}
+	display := func(addr string) string {
+		if !internal.IsAddress(addr) {
+			return addr
+		}
+		if _, ok := names[addr]; !ok {
+			names[addr] = primaryName(addr)
+		}
+		if names[addr] == "" {
+			return addr
+		}
+		return names[addr]
+	}
+
+	fmt.Printf("Transaction history for %s:\n", display(addr))
 	for _, block := range blocks {
 		for _, tx := range block.Transactions {
-			if tx.From == addr || tx.To == addr {
+			to := tx.To
+			if tx.Type == internal.TxBuy || (tx.Type == internal.TxTransfer && !internal.IsAddress(tx.To)) {
+				if payee := resolvedPayee(tx.Hash()); payee != "" {
+					to = payee
+				}
+			}
+			if tx.From == addr || to == addr {
+				dest := display(to)
+				if to != tx.To && tx.To != "" {
+					dest = fmt.Sprintf("%s (via %s)", dest, tx.To)
+				}
 				fmt.Printf("Block %d | Type: %s | From: %s | To: %s | Amount: %.8f | Name: %s\n",
-					block.Index, tx.Type, tx.From, tx.To, tx.Price, tx.Name)
+					block.Index, tx.Type, display(tx.From), dest, tx.Price, tx.Name)
 			}
 		}
 	}
 }
+
+// resolvedPayee returns the address a mined tx sent to a name or buying
+// one paid, or "" if the node recorded none.
+func resolvedPayee(hash string) string {
+	resp, err := http.Get(nodeURL + "/tx/confirm?hash=" + hash)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Payee string `json:"payee"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return ""
+	}
+	return body.Payee
+}
+
+// primaryName returns the primary name of addr, or "" if it has none.
+func primaryName(addr string) string {
+	resp, err := http.Get(nodeURL + "/addresses/" + addr + "/name")
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return ""
+	}
+	return body.Name
+}
+
+func showNameHistory(reader *bufio.Reader) {
+	fmt.Print("Domain name: ")
+	name, _ := reader.ReadString('\n')
+	name = canonicalName(name)
+
+	resp, err := http.Get(nodeURL + "/names/" + name + "/history")
+	if err != nil {
+		fmt.Println("Error fetching history:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("No history for %s\n", name)
+		return
+	}
+
+	var events []internal.NameEvent
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		fmt.Println("Error decoding history:", err)
+		return
+	}
+
+	fmt.Printf("History of %s:\n", name)
+	for _, e := range events {
+		fmt.Printf("Block %d | Tx: %s | Type: %s | From: %s | Owner: %s | Price: %.8f\n",
+			e.Block, e.Tx, e.Type, e.From, e.Owner, e.Price)
+	}
+}
+
+func exportZone(reader *bufio.Reader) {
+	fmt.Print("Write zone file to (empty to print): ")
+	path, _ := reader.ReadString('\n')
+	path = strings.TrimSpace(path)
+
+	resp, err := http.Get(nodeURL + "/zone")
+	if err != nil {
+		fmt.Println("Error fetching zone:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	zone, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Println("Error reading zone:", err)
+		return
+	}
+	if path == "" {
+		fmt.Print(string(zone))
+		return
+	}
+	if err := os.WriteFile(path, zone, 0644); err != nil {
+		fmt.Println("Error writing zone file:", err)
+		return
+	}
+	fmt.Printf("Zone written to %s\n", path)
+}
@@ -18,7 +18,7 @@ const (
 	MempoolEndpoint     = NodeURL + "/tx/pool"
 	BlocksEndpoint      = NodeURL + "/blocks"
 	SubmitBlockEndpoint = NodeURL + "/block"
-	BlockReward         = float64(100)
+	SupplyEndpoint      = NodeURL + "/supply"
 	MaxFeePerTx         = float64(1000)
 	MaxPendingPerUser   = 5
 )
@@ -48,9 +48,25 @@ func main() {
 			continue
 		}
 
-		chainTip := blocks[len(blocks)-1]
+		supply, err := fetchSupply(SupplyEndpoint)
+		if err != nil {
+			log.Printf("[MINER] Failed to fetch supply: %v", err)
+			continue
+		}
 
-		block, validTxs, err := buildBlock(chainTip, mempool, rewardAddress)
+		// The supply must describe the same tip as the blocks
+		if supply.Height != len(blocks) {
+			log.Printf("[MINER] Chain moved while fetching, retrying...")
+			continue
+		}
+
+		chain := make([]*internal.Block, len(blocks))
+		for i := range blocks {
+			chain[i] = &blocks[i]
+		}
+
+		subsidy := internal.BlockSubsidy(len(blocks), supply.Issued)
+		block, validTxs, err := buildBlock(chain, mempool, rewardAddress, subsidy)
 		if err != nil {
 			log.Printf("[MINER] Failed to build block: %v", err)
 			continue
@@ -66,7 +82,7 @@ func main() {
 			continue
 		}
 
-		log.Printf("[MINED] Block #%d with %d txs (reward: %.10f)\n", block.Index, len(validTxs), BlockReward)
+		log.Printf("[MINED] Block #%d with %d txs (reward: %.10f)\n", block.Index, len(validTxs), block.Transactions[0].Price)
 	}
 }
 
@@ -94,24 +110,44 @@ func fetchBlocks(url string) ([]internal.Block, error) {
 	return blocks, err
 }
 
-func buildBlock(tip internal.Block, mempool []internal.Transaction, rewardAddress string) (internal.Block, []internal.Transaction, error) {
+func fetchSupply(url string) (internal.Supply, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return internal.Supply{}, err
+	}
+	defer resp.Body.Close()
+
+	var supply internal.Supply
+	err = json.NewDecoder(resp.Body).Decode(&supply)
+	return supply, err
+}
+
+func buildBlock(chain []*internal.Block, mempool []internal.Transaction, rewardAddress string, subsidy float64) (internal.Block, []internal.Transaction, error) {
+	tip := chain[len(chain)-1]
 	var validTxs []internal.Transaction
 	totalFees := float64(0)
 	pendingCount := map[string]int{}
+	// Once a tx is left out, later ones from its sender would skip a nonce
+	skipped := map[string]bool{}
 
 	for _, tx := range mempool {
 		fmt.Printf("%#v\n", tx)
+		if tx.From == "nebula" {
+			continue
+		}
 		addr, err := internal.RecoverAddressFromTransaction(tx)
 		if err != nil || addr != tx.From {
 			continue
 		}
 
-		if tx.Fee > MaxFeePerTx {
+		if skipped[tx.From] || tx.Fee < 0 || tx.Fee > MaxFeePerTx {
+			skipped[tx.From] = true
 			continue
 		}
 
 		pendingCount[tx.From]++
 		if pendingCount[tx.From] > MaxPendingPerUser {
+			skipped[tx.From] = true
 			continue
 		}
 
@@ -130,21 +166,22 @@ func buildBlock(tip internal.Block, mempool []internal.Transaction, rewardAddres
 		Type:  internal.TxTransfer,
 		From:  "nebula",
 		To:    rewardAddress,
-		Price: BlockReward + totalFees,
+		Price: subsidy + totalFees,
 		Fee:   0,
 	}
 
 	newBlock := internal.Block{
 		Index:        tip.Index + 1,
-		Timestamp:    time.Now().Unix(),
+		Timestamp:    max(time.Now().Unix(), tip.Timestamp),
 		Transactions: append([]internal.Transaction{rewardTx}, validTxs...),
 		PrevHash:     tip.Hash,
+		Bits:         internal.NextBits(chain),
 		Nonce:        0,
 	}
 
 	for {
 		hash := newBlock.CalculateHash()
-		if hash[:4] == "0000" {
+		if internal.MeetsTarget(hash, newBlock.Bits) {
 			newBlock.Hash = hash
 			break
 		}
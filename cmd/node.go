@@ -17,11 +17,18 @@ import (
 	"nebula/internal"
 )
 
+// NameInfo is a registry entry as served by the name endpoints.
+type NameInfo struct {
+	internal.NameEntry
+	Status string `json:"status"`
+}
+
 type Node struct {
 	sync.Mutex
 	Chain *internal.Blockchain
 	Pool  []internal.Transaction
 	Peers []string
+	Zone  string
 }
 
 func main() {
@@ -30,7 +37,11 @@ func main() {
 		log.Printf("[WARN] Failed to load nebula.env, using defaults: %v\n", err)
 	}
 
-	blockchain, err := internal.NewBlockchain(config.DBPath)
+	if config.ChainID == "" {
+		config.ChainID = internal.DefaultChainID
+	}
+
+	blockchain, err := internal.NewBlockchain(config.DBPath, config.ChainID)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -40,18 +51,38 @@ func main() {
 		Chain: blockchain,
 		Pool:  []internal.Transaction{},
 		Peers: config.BootstrapPeers,
+		Zone:  config.DNSZone,
 	}
 
 	go node.SyncLoop()
 
+	dns := internal.NewDNSServer(config.DNSZone, node.LookupName)
+	if config.DNSListen != "" {
+		go func() {
+			log.Printf("Nebula DNS running at %s (zone %s)\n", config.DNSListen, config.DNSZone)
+			log.Fatal(dns.ListenAndServe(config.DNSListen))
+		}()
+	}
+
 	router := mux.NewRouter()
 	router.HandleFunc("/balance", node.HandleBalance).Queries("address", "{address}").Methods("GET")
+	router.HandleFunc("/chain", node.HandleChainID).Methods("GET")
+	router.HandleFunc("/nonce", node.HandleNonce).Queries("address", "{address}").Methods("GET")
 	router.HandleFunc("/tx", node.HandleTx)
 	router.HandleFunc("/blocks", node.HandleBlocks)
 	router.HandleFunc("/tx/confirm", node.HandleConfirm)
 	router.HandleFunc("/tx/pool", node.HandleMempool)
 	router.HandleFunc("/block", node.HandleSubmitBlock)
 	router.HandleFunc("/peers", node.HandlePeers)
+	router.HandleFunc("/names", node.HandleNamesByOwner).Queries("owner", "{owner}").Methods("GET")
+	router.HandleFunc("/names/{name}", node.HandleName).Methods("GET")
+	router.HandleFunc("/names/{name}/history", node.HandleNameHistory).Methods("GET")
+	router.HandleFunc("/names/{name}/offers", node.HandleOffers).Methods("GET")
+	router.HandleFunc("/addresses/{addr}/name", node.HandlePrimaryName).Methods("GET")
+	router.HandleFunc("/supply", node.HandleSupply).Methods("GET")
+	router.HandleFunc("/zone", node.HandleZone).Methods("GET")
+	router.Handle("/dns-query", dns).Methods("GET", "POST")
+	router.HandleFunc("/auctions/{name}", node.HandleAuction).Methods("GET")
 
 	log.Printf("Nebula node running at :%d\n", config.Port)
 	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(config.Port), router))
@@ -114,10 +145,14 @@ func (n *Node) SyncLoop() {
 							continue
 						}
 						balance := n.Chain.GetBalanceWithPending(tx.From, n.Pool)
-						if balance < tx.Price+tx.Fee {
+						if balance < tx.Cost() {
 							log.Printf("[MEMPOOL SYNC] Rejected tx from %s: insufficient balance\n", tx.From)
 							continue
 						}
+						if err := n.Chain.ValidateTx(tx, n.Pool); err != nil {
+							log.Printf("[MEMPOOL SYNC] Rejected tx from %s: %v\n", tx.From, err)
+							continue
+						}
 						n.Pool = append(n.Pool, tx)
 						added++
 					}
@@ -153,6 +188,12 @@ func (n *Node) SyncLoop() {
 	}
 }
 
+func (n *Node) LookupName(name string) (internal.NameEntry, bool, error) {
+	n.Lock()
+	defer n.Unlock()
+	return n.Chain.ResolveName(name)
+}
+
 func (n *Node) HandlePeers(w http.ResponseWriter, r *http.Request) {
 	n.Lock()
 	defer n.Unlock()
@@ -169,6 +210,187 @@ func (n *Node) HandleBalance(w http.ResponseWriter, r *http.Request) {
 	_, _ = io.WriteString(w, fmt.Sprintf("%v", bal))
 }
 
+func (n *Node) HandleChainID(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.WriteString(w, n.Chain.ChainID)
+}
+
+func (n *Node) HandleNonce(w http.ResponseWriter, r *http.Request) {
+	addr := mux.Vars(r)["address"]
+
+	n.Lock()
+	defer n.Unlock()
+
+	nonce, err := n.Chain.NextNonce(addr, n.Pool)
+	if err != nil {
+		http.Error(w, "failed to read nonce", http.StatusInternalServerError)
+		log.Printf("[ERROR] Reading nonce of %s: %v", addr, err)
+		return
+	}
+	_, _ = io.WriteString(w, strconv.FormatUint(nonce, 10))
+}
+
+func (n *Node) HandleName(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	n.Lock()
+	defer n.Unlock()
+
+	entry, found, err := n.Chain.LookupName(name)
+	if err != nil {
+		http.Error(w, "failed to read name state", http.StatusInternalServerError)
+		log.Printf("[ERROR] Looking up name %s: %v", name, err)
+		return
+	}
+	if !found || entry.Status(n.Chain.Height()) == internal.NameExpired {
+		http.Error(w, "name not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NameInfo{NameEntry: entry, Status: entry.Status(n.Chain.Height())})
+}
+
+func (n *Node) HandleNameHistory(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	n.Lock()
+	defer n.Unlock()
+
+	events, err := n.Chain.NameHistory(name)
+	if err != nil {
+		http.Error(w, "failed to read name state", http.StatusInternalServerError)
+		log.Printf("[ERROR] Reading history of %s: %v", name, err)
+		return
+	}
+	if len(events) == 0 {
+		http.Error(w, "name not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+func (n *Node) HandleOffers(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	n.Lock()
+	defer n.Unlock()
+
+	offers, err := n.Chain.Offers(name)
+	if err != nil {
+		http.Error(w, "failed to read name state", http.StatusInternalServerError)
+		log.Printf("[ERROR] Listing offers on %s: %v", name, err)
+		return
+	}
+
+	open := make([]internal.Offer, 0, len(offers))
+	for _, o := range offers {
+		if o.ExpiresAt > n.Chain.Height() {
+			open = append(open, o)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(open)
+}
+
+func (n *Node) HandleNamesByOwner(w http.ResponseWriter, r *http.Request) {
+	owner := mux.Vars(r)["owner"]
+
+	n.Lock()
+	defer n.Unlock()
+
+	names, err := n.Chain.NamesByOwner(owner)
+	if err != nil {
+		http.Error(w, "failed to read name state", http.StatusInternalServerError)
+		log.Printf("[ERROR] Listing names of %s: %v", owner, err)
+		return
+	}
+
+	infos := make([]NameInfo, 0, len(names))
+	for _, entry := range names {
+		infos = append(infos, NameInfo{NameEntry: entry, Status: entry.Status(n.Chain.Height())})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
+
+func (n *Node) HandlePrimaryName(w http.ResponseWriter, r *http.Request) {
+	addr := mux.Vars(r)["addr"]
+
+	n.Lock()
+	defer n.Unlock()
+
+	name, found, err := n.Chain.PrimaryName(addr)
+	if err != nil {
+		http.Error(w, "failed to read name state", http.StatusInternalServerError)
+		log.Printf("[ERROR] Looking up primary name of %s: %v", addr, err)
+		return
+	}
+	if !found {
+		http.Error(w, "no primary name", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"address": addr, "name": name})
+}
+
+func (n *Node) HandleSupply(w http.ResponseWriter, r *http.Request) {
+	n.Lock()
+	defer n.Unlock()
+
+	supply, err := n.Chain.Supply()
+	if err != nil {
+		http.Error(w, "failed to read supply", http.StatusInternalServerError)
+		log.Printf("[ERROR] Reading supply: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(supply)
+}
+
+func (n *Node) HandleZone(w http.ResponseWriter, r *http.Request) {
+	n.Lock()
+	defer n.Unlock()
+
+	names, err := n.Chain.ActiveNames()
+	if err != nil {
+		http.Error(w, "failed to read name state", http.StatusInternalServerError)
+		log.Printf("[ERROR] Listing names for zone export: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/dns")
+	if err := internal.WriteZone(w, internal.ZoneOrigin(n.Zone), n.Chain.GetLatestBlock().Index, names); err != nil {
+		log.Printf("[ERROR] Writing zone: %v", err)
+	}
+}
+
+func (n *Node) HandleAuction(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	n.Lock()
+	defer n.Unlock()
+
+	auction, found, err := n.Chain.LookupAuction(name)
+	if err != nil {
+		http.Error(w, "failed to read name state", http.StatusInternalServerError)
+		log.Printf("[ERROR] Looking up auction %s: %v", name, err)
+		return
+	}
+	if !found {
+		http.Error(w, "auction not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(auction)
+}
+
 func (n *Node) HandleTx(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
@@ -188,18 +410,29 @@ func (n *Node) HandleTx(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[DEBUG] err: %v, recovered addr: %s\n", err, addr)
 		return
 	}
+	if tx.ChainID != n.Chain.ChainID {
+		http.Error(w, "tx signed for chain "+strconv.Quote(tx.ChainID), http.StatusBadRequest)
+		log.Printf("[REJECTED] Tx from %s signed for chain %q\n", tx.From, tx.ChainID)
+		return
+	}
 
 	n.Lock()
 	defer n.Unlock()
 
 	balance := n.Chain.GetBalanceWithPending(tx.From, n.Pool)
-	totalCost := tx.Price + tx.Fee
+	totalCost := tx.Cost()
 	if balance < totalCost {
 		http.Error(w, "insufficient funds", http.StatusBadRequest)
 		log.Printf("[REJECTED] Not enough funds for %s: has %.10f, needs %.10f (including fee %.10f)\n", tx.From, balance, totalCost, tx.Fee)
 		return
 	}
 
+	if err := n.Chain.ValidateTx(tx, n.Pool); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("[REJECTED] Invalid %s tx from %s: %v\n", tx.Type, tx.From, err)
+		return
+	}
+
 	n.Pool = append(n.Pool, tx)
 	log.Printf("[TX RECEIVED] %s -> %s (%s) amount %.10f\n", tx.From, tx.To, tx.Type, tx.Price)
 	w.WriteHeader(http.StatusOK)
@@ -228,8 +461,18 @@ func (n *Node) HandleConfirm(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// A tx sent to a name, or buying one, paid whoever owned it when mined
+	payee, _, err := n.Chain.ResolvedPayee(hash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"confirmations": confirmations})
+	json.NewEncoder(w).Encode(struct {
+		Confirmations int    `json:"confirmations"`
+		Payee         string `json:"payee,omitempty"`
+	}{confirmations, payee})
 }
 
 func (n *Node) HandleMempool(w http.ResponseWriter, r *http.Request) {
@@ -262,28 +505,27 @@ func (n *Node) HandleSubmitBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	latest := n.Chain.GetLatestBlock()
-	if block.PrevHash != latest.Hash {
-		http.Error(w, "block PrevHash mismatch with chain tip", http.StatusBadRequest)
-		return
-	}
-
 	if err := n.Chain.AddBlock(&block); err != nil {
 		http.Error(w, "failed to persist block", http.StatusInternalServerError)
 		log.Printf("[ERROR] Saving block: %v", err)
 		return
 	}
 
-	// Remove included txs
+	// Remove included txs and any that the new block made invalid
 	included := make(map[string]struct{})
 	for _, tx := range block.Transactions {
 		included[tx.Hash()] = struct{}{}
 	}
 	newPool := n.Pool[:0]
 	for _, tx := range n.Pool {
-		if _, found := included[tx.Hash()]; !found {
-			newPool = append(newPool, tx)
+		if _, found := included[tx.Hash()]; found {
+			continue
+		}
+		if err := n.Chain.ValidateTx(tx, newPool); err != nil {
+			log.Printf("[MEMPOOL] Dropped %s tx from %s: %v", tx.Type, tx.From, err)
+			continue
 		}
+		newPool = append(newPool, tx)
 	}
 	n.Pool = newPool
 
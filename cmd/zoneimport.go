@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"nebula/internal"
+)
+
+const (
+	NodeURL       = "http://localhost:8080"
+	TxEndpoint    = NodeURL + "/tx"
+	NamesEndpoint = NodeURL + "/names?owner="
+	NonceEndpoint = NodeURL + "/nonce?address="
+	ChainEndpoint = NodeURL + "/chain"
+	ImportFee     = float64(1)
+)
+
+// zoneimport turns the records of a zone file into signed SET_IP and
+// SET_RECORDS transactions for the names owned by wallet.pk.
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatalf("Usage: zoneimport <zone_file> [zone]")
+	}
+	origin := ".nebula"
+	if len(os.Args) > 2 {
+		origin = os.Args[2]
+	}
+
+	wallet, err := internal.LoadWalletFromFile("wallet.pk")
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+
+	f, err := os.Open(os.Args[1])
+	if err != nil {
+		log.Fatalf("Failed to open zone file: %v", err)
+	}
+	zone, err := internal.ParseZone(f, origin)
+	f.Close()
+	if err != nil {
+		log.Fatalf("Failed to parse zone file: %v", err)
+	}
+
+	owned, err := fetchOwnedNames(wallet.Address)
+	if err != nil {
+		log.Fatalf("Failed to fetch names: %v", err)
+	}
+
+	chainID, err := fetchText(ChainEndpoint)
+	if err != nil {
+		log.Fatalf("Failed to fetch chain id: %v", err)
+	}
+	nonceText, err := fetchText(NonceEndpoint + wallet.Address)
+	if err != nil {
+		log.Fatalf("Failed to fetch nonce: %v", err)
+	}
+	nonce, err := strconv.ParseUint(nonceText, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid nonce %q", nonceText)
+	}
+
+	names := make([]string, 0, len(zone))
+	for name := range zone {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		records := zone[name]
+		entry, ok := owned[name]
+		if !ok {
+			log.Printf("[IMPORT] Skipping %s: not owned by %s", name, wallet.Address)
+			continue
+		}
+		if err := internal.ValidateRecords(records); err != nil {
+			log.Printf("[IMPORT] Skipping %s: %v", name, err)
+			continue
+		}
+		if reflect.DeepEqual(records, entry.Records) {
+			log.Printf("[IMPORT] %s is up to date", name)
+			continue
+		}
+
+		tx := recordsTx(entry, records)
+		tx.From = wallet.Address
+		tx.ChainID = chainID
+		tx.Nonce = nonce
+		if err := internal.SignTransaction(&tx, wallet.PrivateKey); err != nil {
+			log.Fatalf("Failed to sign tx: %v", err)
+		}
+		if err := submitTx(tx); err != nil {
+			log.Printf("[IMPORT] %s %s rejected: %v", tx.Type, name, err)
+			continue
+		}
+		nonce++
+		log.Printf("[IMPORT] Sent %s for %s (%d records)", tx.Type, name, len(records))
+	}
+}
+
+// recordsTx returns the tx that gives entry the records of the zone. A
+// lone address replacing addresses is a SET_IP; anything else replaces
+// the whole record set.
+func recordsTx(entry internal.NameEntry, records []internal.Record) internal.Transaction {
+	onlyAddresses := true
+	for _, r := range entry.Records {
+		if r.Type != internal.RecordA && r.Type != internal.RecordAAAA {
+			onlyAddresses = false
+		}
+	}
+
+	if len(records) == 1 && onlyAddresses &&
+		(records[0].Type == internal.RecordA || records[0].Type == internal.RecordAAAA) {
+		return internal.Transaction{
+			Type: internal.TxSetIP,
+			Name: entry.Name,
+			Fee:  ImportFee,
+			Payload: map[string]string{
+				"ip":  records[0].Value,
+				"ttl": strconv.FormatUint(uint64(records[0].TTL), 10),
+			},
+		}
+	}
+	return internal.Transaction{
+		Type:    internal.TxSetRecords,
+		Name:    entry.Name,
+		Fee:     ImportFee,
+		Records: records,
+	}
+}
+
+// fetchOwnedNames returns the active names owned by addr.
+func fetchOwnedNames(addr string) (map[string]internal.NameEntry, error) {
+	resp, err := http.Get(NamesEndpoint + addr)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var infos []struct {
+		internal.NameEntry
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		return nil, err
+	}
+
+	owned := map[string]internal.NameEntry{}
+	for _, info := range infos {
+		if info.Status == internal.NameActive {
+			owned[info.Name] = info.NameEntry
+		}
+	}
+	return owned, nil
+}
+
+// fetchText returns the plain-text body of a node endpoint.
+func fetchText(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", bytes.TrimSpace(body))
+	}
+	return string(bytes.TrimSpace(body)), nil
+}
+
+func submitTx(tx internal.Transaction) error {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(TxEndpoint, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		reason, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s", bytes.TrimSpace(reason))
+	}
+	return nil
+}
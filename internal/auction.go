@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	// AuctionBiddingBlocks is how long an auction takes sealed bids,
+	// counted from the first bid.
+	AuctionBiddingBlocks = 100
+	// AuctionRevealBlocks is how long bidders have to reveal once
+	// bidding closes.
+	AuctionRevealBlocks = 50
+	// MaxAuctionBids bounds the number of sealed bids on one name.
+	MaxAuctionBids = 100
+)
+
+// EscrowAddress holds deposits until the state rules release them.
+const EscrowAddress = "escrow"
+
+const auctionKeyPrefix = "auction-"
+
+func auctionKey(name string) string {
+	return auctionKeyPrefix + name
+}
+
+// SealedBid is a bid in an auction. Value is only known once revealed.
+type SealedBid struct {
+	Bidder     string  `json:"bidder"`
+	Commitment string  `json:"commitment"`
+	Deposit    float64 `json:"deposit"`
+	Value      float64 `json:"value,omitempty"`
+	Revealed   bool    `json:"revealed"`
+}
+
+// Auction is a Vickrey auction for a name that is not registered.
+type Auction struct {
+	Name        string      `json:"name"`
+	OpenedAt    int         `json:"opened_at"`
+	BiddingEnds int         `json:"bidding_ends"`
+	RevealEnds  int         `json:"reveal_ends"`
+	Bids        []SealedBid `json:"bids"`
+}
+
+// BidCommitment returns the hash a BID publishes for a bid of value on
+// name by addr, which REVEAL_BID later opens with salt.
+func BidCommitment(name string, value float64, salt, addr string) string {
+	v := strconv.FormatFloat(value, 'f', -1, 64)
+	h := sha256.Sum256([]byte(name + "\x00" + v + "\x00" + salt + "\x00" + addr))
+	return hex.EncodeToString(h[:])
+}
+
+// LookupAuction returns the auction for name, if one is running.
+func (r *Registry) LookupAuction(name string) (Auction, bool, error) {
+	var a Auction
+	found, err := r.state.get(auctionKey(name), &a)
+	return a, found, err
+}
+
+// bid records a sealed bid, opening an auction if the name has none.
+// The deposit itself reaches escrow as the value of the tx.
+func (r *Registry) bid(tx Transaction, entry NameEntry, exists bool, height int) error {
+	if exists && entry.Status(height) != NameExpired {
+		return fmt.Errorf("name %q is already registered", tx.Name)
+	}
+	if tx.To != EscrowAddress {
+		return errors.New("bid deposit must be paid to escrow")
+	}
+	if tx.Price <= 0 {
+		return errors.New("bid deposit must be positive")
+	}
+	if b, err := hex.DecodeString(tx.Commitment); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("invalid commitment %q", tx.Commitment)
+	}
+
+	a, found, err := r.LookupAuction(tx.Name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		a = Auction{
+			Name:        tx.Name,
+			OpenedAt:    height,
+			BiddingEnds: height + AuctionBiddingBlocks,
+			RevealEnds:  height + AuctionBiddingBlocks + AuctionRevealBlocks,
+			Bids:        []SealedBid{},
+		}
+	}
+	if height >= a.BiddingEnds {
+		return fmt.Errorf("bidding on %q closed at block %d", tx.Name, a.BiddingEnds)
+	}
+	if len(a.Bids) >= MaxAuctionBids {
+		return fmt.Errorf("auction for %q is full", tx.Name)
+	}
+	for _, b := range a.Bids {
+		if b.Bidder == tx.From && b.Commitment == tx.Commitment {
+			return errors.New("duplicate bid commitment")
+		}
+	}
+
+	a.Bids = append(a.Bids, SealedBid{Bidder: tx.From, Commitment: tx.Commitment, Deposit: tx.Price})
+	return r.state.put(auctionKey(tx.Name), a)
+}
+
+// revealBid opens a sealed bid. The revealed value may not exceed the
+// deposit backing it, nor fall below the registration price of the name.
+func (r *Registry) revealBid(tx Transaction, height int) error {
+	a, found, err := r.LookupAuction(tx.Name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no auction for %q", tx.Name)
+	}
+	if height < a.BiddingEnds || height >= a.RevealEnds {
+		return fmt.Errorf("reveals for %q are accepted from block %d to %d", tx.Name, a.BiddingEnds, a.RevealEnds-1)
+	}
+
+	commitment := BidCommitment(tx.Name, tx.Price, tx.Salt, tx.From)
+	for i, b := range a.Bids {
+		if b.Commitment != commitment || b.Bidder != tx.From {
+			continue
+		}
+		if b.Revealed {
+			return errors.New("bid already revealed")
+		}
+		if tx.Price > b.Deposit {
+			return fmt.Errorf("bid %.10f is not covered by deposit %.10f", tx.Price, b.Deposit)
+		}
+		if price := NamePrice(tx.Name); tx.Price < price {
+			return fmt.Errorf("bid %.10f is below the registration price %.10f", tx.Price, price)
+		}
+		a.Bids[i].Value = tx.Price
+		a.Bids[i].Revealed = true
+		return r.state.put(auctionKey(tx.Name), a)
+	}
+	return fmt.Errorf("no matching bid from %s on %q", tx.From, tx.Name)
+}
+
+// cancelAuction ends an auction without a winner, refunding every deposit
+// in full. It is called when a registration committed before the first
+// bid claims the name.
+func (r *Registry) cancelAuction(a Auction) error {
+	for _, b := range a.Bids {
+		if err := r.state.debit(EscrowAddress, b.Deposit); err != nil {
+			return err
+		}
+		if err := r.state.credit(b.Bidder, b.Deposit); err != nil {
+			return err
+		}
+	}
+	r.state.delete(auctionKey(a.Name))
+	return nil
+}
+
+// settle closes an auction after its reveal period. The highest revealed
+// bidder is registered as owner and pays the second-highest bid, or the
+// registration price of the name when unopposed. Other revealed bids are refunded in full;
+// unrevealed deposits are forfeited to nebula.
+func (r *Registry) settle(tx Transaction, height int) (NameEntry, bool, error) {
+	a, found, err := r.LookupAuction(tx.Name)
+	if err != nil {
+		return NameEntry{}, false, err
+	}
+	if !found {
+		return NameEntry{}, false, fmt.Errorf("no auction for %q", tx.Name)
+	}
+	if height < a.RevealEnds {
+		return NameEntry{}, false, fmt.Errorf("auction for %q cannot settle before block %d", tx.Name, a.RevealEnds)
+	}
+
+	winner, second := -1, float64(0)
+	for i, b := range a.Bids {
+		if !b.Revealed {
+			continue
+		}
+		if winner < 0 || b.Value > a.Bids[winner].Value {
+			if winner >= 0 {
+				second = a.Bids[winner].Value
+			}
+			winner = i
+		} else if b.Value > second {
+			second = b.Value
+		}
+	}
+	price := math.Max(second, NamePrice(tx.Name))
+	if winner >= 0 {
+		price = math.Min(price, a.Bids[winner].Value)
+	}
+
+	for i, b := range a.Bids {
+		refund, burn := b.Deposit, float64(0)
+		switch {
+		case i == winner:
+			refund, burn = b.Deposit-price, price
+		case !b.Revealed:
+			refund, burn = 0, b.Deposit
+		}
+		if err := r.state.debit(EscrowAddress, b.Deposit); err != nil {
+			return NameEntry{}, false, err
+		}
+		if err := r.state.credit(b.Bidder, refund); err != nil {
+			return NameEntry{}, false, err
+		}
+		if err := r.state.credit("nebula", burn); err != nil {
+			return NameEntry{}, false, err
+		}
+	}
+	r.state.delete(auctionKey(tx.Name))
+
+	if winner < 0 {
+		return NameEntry{}, false, nil
+	}
+	return NameEntry{
+		Name:         tx.Name,
+		Owner:        a.Bids[winner].Bidder,
+		Records:      []Record{},
+		RegisteredAt: height,
+		ExpiresAt:    height + NameLeaseBlocks,
+	}, true, nil
+}
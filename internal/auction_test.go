@@ -0,0 +1,287 @@
+package internal
+
+import "testing"
+
+const testSalt = "0123456789abcdef"
+
+func bidTx(t *testing.T, bc *Blockchain, w *Wallet, name string, value, deposit float64) Transaction {
+	t.Helper()
+	return signTx(t, bc, w, Transaction{
+		Type:       TxBid,
+		To:         EscrowAddress,
+		Name:       name,
+		Price:      deposit,
+		Fee:        1,
+		Commitment: BidCommitment(name, value, testSalt, w.Address),
+	})
+}
+
+func commitTx(t *testing.T, bc *Blockchain, w *Wallet, name string) Transaction {
+	t.Helper()
+	return signTx(t, bc, w, Transaction{Type: TxCommit, Fee: 1, Commitment: Commitment(name, testSalt, w.Address)})
+}
+
+func registerTx(t *testing.T, bc *Blockchain, w *Wallet, name string) Transaction {
+	t.Helper()
+	return signTx(t, bc, w, Transaction{Type: TxRegister, To: "nebula", Name: name, Price: NamePrice(name), Fee: 1, Salt: testSalt})
+}
+
+func TestRegisterCommittedBeforeBidCancelsAuction(t *testing.T) {
+	bc := newTestChain(t)
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	addBlock(t, bc, alice.Address)
+	addBlock(t, bc, bob.Address)
+
+	name := "frontrun"
+	addBlock(t, bc, alice.Address, commitTx(t, bc, alice, name))
+	addBlock(t, bc, alice.Address, bidTx(t, bc, bob, name, 20, 30))
+	bobBalance := bc.GetBalance(bob.Address)
+
+	addBlock(t, bc, alice.Address, registerTx(t, bc, alice, name))
+
+	entry, found, err := bc.LookupName(name)
+	if err != nil || !found || entry.Owner != alice.Address {
+		t.Fatalf("name not registered to alice: %+v (%v)", entry, err)
+	}
+	if _, running, err := bc.LookupAuction(name); err != nil || running {
+		t.Fatalf("auction still running (%v)", err)
+	}
+	if got := bc.GetBalance(bob.Address); got != bobBalance+30 {
+		t.Errorf("bob balance %v, want deposit refunded to %v", got, bobBalance+30)
+	}
+	if got := bc.GetBalance(EscrowAddress); got != 0 {
+		t.Errorf("escrow holds %v after cancel", got)
+	}
+}
+
+func TestRegisterCommittedAfterBidIsRejected(t *testing.T) {
+	bc := newTestChain(t)
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	addBlock(t, bc, alice.Address)
+	addBlock(t, bc, bob.Address)
+
+	name := "auctioned"
+	addBlock(t, bc, alice.Address, bidTx(t, bc, bob, name, 20, 30))
+	addBlock(t, bc, alice.Address, commitTx(t, bc, alice, name))
+
+	if err := bc.ValidateTx(registerTx(t, bc, alice, name), nil); err == nil {
+		t.Fatal("registration committed after the first bid was accepted")
+	}
+}
+
+// auctionState applies txs straight to a state view at chosen heights, as
+// an auction spans more blocks than a test should mine.
+type auctionState struct {
+	t    *testing.T
+	view *stateView
+}
+
+func newAuctionState(t *testing.T, wallets ...*Wallet) *auctionState {
+	t.Helper()
+	s := &auctionState{t: t, view: newStateView(newTestChain(t).db)}
+	for _, w := range wallets {
+		if err := s.view.debit("nebula", 1000); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.view.credit(w.Address, 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func (s *auctionState) apply(w *Wallet, tx Transaction, height int) error {
+	s.t.Helper()
+	nonce, err := s.view.nonce(w.Address)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	tx.From, tx.Nonce, tx.Fee = w.Address, nonce, 1
+	return applyTx(s.view, tx, height)
+}
+
+func (s *auctionState) mustApply(w *Wallet, tx Transaction, height int) {
+	s.t.Helper()
+	if err := s.apply(w, tx, height); err != nil {
+		s.t.Fatalf("%s from %s at %d: %v", tx.Type, w.Address, height, err)
+	}
+}
+
+func (s *auctionState) bid(w *Wallet, name string, value, deposit float64, height int) {
+	s.t.Helper()
+	s.mustApply(w, Transaction{
+		Type:       TxBid,
+		To:         EscrowAddress,
+		Name:       name,
+		Price:      deposit,
+		Commitment: BidCommitment(name, value, testSalt, w.Address),
+	}, height)
+}
+
+func (s *auctionState) reveal(w *Wallet, name string, value float64, height int) {
+	s.t.Helper()
+	s.mustApply(w, Transaction{Type: TxRevealBid, Name: name, Price: value, Salt: testSalt}, height)
+}
+
+func (s *auctionState) settle(w *Wallet, name string, height int) {
+	s.t.Helper()
+	s.mustApply(w, Transaction{Type: TxSettleAuction, Name: name}, height)
+}
+
+func (s *auctionState) balance(addr string) float64 {
+	s.t.Helper()
+	bal, err := s.view.balance(addr)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return bal
+}
+
+func (s *auctionState) owner(name string) string {
+	s.t.Helper()
+	entry, found, err := NewRegistry(s.view).Lookup(name)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if !found {
+		return ""
+	}
+	return entry.Owner
+}
+
+const (
+	bidHeight    = 10
+	revealHeight = bidHeight + AuctionBiddingBlocks
+	settleHeight = revealHeight + AuctionRevealBlocks
+)
+
+func TestAuctionSettlesAtSecondPrice(t *testing.T) {
+	alice, bob, carol, dave := newTestWallet(t), newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	s := newAuctionState(t, alice, bob, carol, dave)
+	name := "vickrey"
+
+	s.bid(alice, name, 50, 80, bidHeight)
+	s.bid(bob, name, 40, 40, bidHeight)
+	s.bid(carol, name, 30, 60, bidHeight)
+	s.bid(dave, name, 70, 100, bidHeight)
+
+	if err := s.apply(alice, Transaction{Type: TxRevealBid, Name: name, Price: 50, Salt: testSalt}, revealHeight-1); err == nil {
+		t.Error("revealed before bidding closed")
+	}
+	s.reveal(alice, name, 50, revealHeight)
+	s.reveal(bob, name, 40, revealHeight)
+	s.reveal(carol, name, 30, revealHeight)
+	// Dave never reveals
+
+	if err := s.apply(alice, Transaction{Type: TxSettleAuction, Name: name}, settleHeight-1); err == nil {
+		t.Error("settled before reveals closed")
+	}
+	s.settle(alice, name, settleHeight)
+
+	if got := s.owner(name); got != alice.Address {
+		t.Fatalf("owner %q, want alice", got)
+	}
+	// Alice pays Bob's bid; losers are refunded and Dave forfeits his deposit
+	want := map[string]float64{
+		alice.Address: 1000 - 3 - 40,
+		bob.Address:   1000 - 2,
+		carol.Address: 1000 - 2,
+		dave.Address:  1000 - 1 - 100,
+		EscrowAddress: 0,
+	}
+	for addr, bal := range want {
+		if got := s.balance(addr); got != bal {
+			t.Errorf("balance of %s is %v, want %v", addr, got, bal)
+		}
+	}
+	supply, err := s.view.supplyCounters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if supply.Burned != 140 {
+		t.Errorf("burned %v, want the price 40 and forfeit 100", supply.Burned)
+	}
+	if _, running, err := NewRegistry(s.view).LookupAuction(name); err != nil || running {
+		t.Errorf("auction still open (%v)", err)
+	}
+}
+
+func TestAuctionTieGoesToFirstBid(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	s := newAuctionState(t, alice, bob)
+	name := "tiedname"
+
+	s.bid(alice, name, 50, 50, bidHeight)
+	s.bid(bob, name, 50, 50, bidHeight)
+	s.reveal(bob, name, 50, revealHeight)
+	s.reveal(alice, name, 50, revealHeight)
+	s.settle(bob, name, settleHeight)
+
+	if got := s.owner(name); got != alice.Address {
+		t.Fatalf("owner %q, want alice", got)
+	}
+	if got := s.balance(alice.Address); got != 1000-2-50 {
+		t.Errorf("alice balance %v, want %v", got, 1000-2-50)
+	}
+	if got := s.balance(bob.Address); got != 1000-3 {
+		t.Errorf("bob balance %v, want %v", got, 1000-3)
+	}
+}
+
+func TestAuctionUnopposedPaysNamePrice(t *testing.T) {
+	alice := newTestWallet(t)
+	s := newAuctionState(t, alice)
+	name := "unopposed"
+
+	s.bid(alice, name, 50, 60, bidHeight)
+	if err := s.apply(alice, Transaction{Type: TxRevealBid, Name: name, Price: 70, Salt: testSalt}, revealHeight); err == nil {
+		t.Error("revealed a bid above its deposit")
+	}
+	s.reveal(alice, name, 50, revealHeight)
+	s.settle(alice, name, settleHeight)
+
+	if got := s.owner(name); got != alice.Address {
+		t.Fatalf("owner %q, want alice", got)
+	}
+	if got, want := s.balance(alice.Address), 1000-3-NamePrice(name); got != want {
+		t.Errorf("alice balance %v, want %v", got, want)
+	}
+	if got := s.balance(EscrowAddress); got != 0 {
+		t.Errorf("escrow holds %v", got)
+	}
+}
+
+func TestAuctionBidBelowNamePriceCannotReveal(t *testing.T) {
+	alice := newTestWallet(t)
+	s := newAuctionState(t, alice)
+	name := "cheap"
+
+	low := NamePrice(name) / 2
+	s.bid(alice, name, low, 100, bidHeight)
+	if err := s.apply(alice, Transaction{Type: TxRevealBid, Name: name, Price: low, Salt: testSalt}, revealHeight); err == nil {
+		t.Fatal("revealed a bid below the name price")
+	}
+}
+
+func TestAuctionWithoutRevealsForfeitsDeposits(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	s := newAuctionState(t, alice, bob)
+	name := "unrevealed"
+
+	s.bid(alice, name, 50, 50, bidHeight)
+	s.bid(bob, name, 40, 70, bidHeight)
+	s.settle(bob, name, settleHeight)
+
+	if got := s.owner(name); got != "" {
+		t.Fatalf("owner %q, want none", got)
+	}
+	if got := s.balance(alice.Address); got != 1000-1-50 {
+		t.Errorf("alice balance %v, want %v", got, 1000-1-50)
+	}
+	if got := s.balance(bob.Address); got != 1000-2-70 {
+		t.Errorf("bob balance %v, want %v", got, 1000-2-70)
+	}
+	if got := s.balance(EscrowAddress); got != 0 {
+		t.Errorf("escrow holds %v", got)
+	}
+}
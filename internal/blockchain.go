@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 	"log"
+	"strings"
+	"time"
 )
 
 type Block struct {
@@ -14,23 +17,27 @@ type Block struct {
 	Timestamp    int64         `json:"timestamp"`
 	Transactions []Transaction `json:"transactions"`
 	PrevHash     string        `json:"prev_hash"`
+	Bits         uint32        `json:"bits"`
 	Nonce        int           `json:"nonce"`
 	Hash         string        `json:"hash"`
 }
 
 type Blockchain struct {
 	Blocks []*Block
-	db     *leveldb.DB
+	// ChainID is the network transactions must be signed for.
+	ChainID string
+	db      *leveldb.DB
 }
 
-func NewBlockchain(dbPath string) (*Blockchain, error) {
+func NewBlockchain(dbPath, chainID string) (*Blockchain, error) {
 	db, err := leveldb.OpenFile(dbPath, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	bc := &Blockchain{
-		db: db,
+		ChainID: chainID,
+		db:      db,
 	}
 
 	err = bc.loadBlocksFromDB()
@@ -48,21 +55,33 @@ func NewBlockchain(dbPath string) (*Blockchain, error) {
 				},
 			},
 			PrevHash: "",
+			Bits:     InitialBits,
 			Nonce:    0,
 		}
 		genesis.Hash = genesis.CalculateHash()
-		bc.Blocks = []*Block{genesis}
-		if err := bc.saveBlockToDB(genesis); err != nil {
+		view := newStateView(db)
+		if err := bc.applyBlock(view, genesis); err != nil {
+			return nil, err
+		}
+		if err := view.put(stateVersionKey, stateVersion); err != nil {
+			return nil, err
+		}
+		if err := view.commit(); err != nil {
 			log.Printf("[ERROR] Failed to save block to DB: %v\n", err)
 			return nil, err
 		}
+		bc.Blocks = []*Block{genesis}
+	}
+
+	if err := bc.syncState(); err != nil {
+		return nil, err
 	}
 
 	return bc, nil
 }
 
 func (bc *Blockchain) loadBlocksFromDB() error {
-	iter := bc.db.NewIterator(nil, nil)
+	iter := bc.db.NewIterator(util.BytesPrefix([]byte(blockKeyPrefix)), nil)
 	defer iter.Release()
 
 	var blocks []*Block
@@ -83,15 +102,44 @@ func (bc *Blockchain) loadBlocksFromDB() error {
 	return nil
 }
 
-func (bc *Blockchain) saveBlockToDB(block *Block) error {
-	data, err := json.Marshal(block)
+// syncState rebuilds the derived state from the stored blocks when it does
+// not match the chain tip, e.g. for databases written before it existed.
+func (bc *Blockchain) syncState() error {
+	view := newStateView(bc.db)
+	var height, version int
+	found, err := view.get(stateHeightKey, &height)
 	if err != nil {
 		return err
 	}
-	key := []byte(fmt.Sprintf("block-%09d", block.Index))
-	err = bc.db.Put(key, data, nil)
-	fmt.Println(bc.db.Has(key, nil))
-	return err
+	if _, err := view.get(stateVersionKey, &version); err != nil {
+		return err
+	}
+	if found && height == bc.GetLatestBlock().Index && version == stateVersion {
+		return nil
+	}
+
+	log.Printf("[STATE] Rebuilding state from %d blocks\n", len(bc.Blocks))
+	iter := bc.db.NewIterator(nil, nil)
+	for iter.Next() {
+		key := string(iter.Key())
+		if !strings.HasPrefix(key, blockKeyPrefix) {
+			view.delete(key)
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	for _, block := range bc.Blocks {
+		if err := bc.applyBlock(view, block); err != nil {
+			return err
+		}
+	}
+	if err := view.put(stateVersionKey, stateVersion); err != nil {
+		return err
+	}
+	return view.commit()
 }
 
 func (bc *Blockchain) ReplaceChain(newBlocks []*Block) error {
@@ -99,38 +147,36 @@ func (bc *Blockchain) ReplaceChain(newBlocks []*Block) error {
 		return errors.New("received chain is not longer")
 	}
 
-	// Validate each block in sequence
-	for i := range newBlocks {
-		if i == 0 {
-			// Genesis block: allow mismatch
-			continue
-		}
-		if newBlocks[i].PrevHash != newBlocks[i-1].Hash {
-			return fmt.Errorf("invalid chain at block %d: hash mismatch", i)
-		}
-		if err := bc.ValidateBlock(newBlocks[i]); err != nil {
-			return fmt.Errorf("block %d invalid: %v", i, err)
-		}
+	if newBlocks[0].Hash != bc.Blocks[0].Hash {
+		return errors.New("received chain has a different genesis block")
 	}
 
-	// Clear LevelDB and replace with new chain
-	iter := bc.db.NewIterator(nil, nil)
-	for iter.Next() {
-		key := iter.Key()
-		if err := bc.db.Delete(key, nil); err != nil {
+	// Find the fork point past the shared genesis block
+	fork := 1
+	for fork < len(bc.Blocks) && newBlocks[fork].Hash == bc.Blocks[fork].Hash {
+		fork++
+	}
+
+	// Roll our blocks back to the fork point using their undo records
+	view := newStateView(bc.db)
+	for i := len(bc.Blocks) - 1; i >= fork; i-- {
+		if err := view.revert(bc.Blocks[i].Index); err != nil {
 			return err
 		}
 	}
-	iter.Release()
 
-	// Save new chain to DB
-	for _, block := range newBlocks {
-		if err := bc.saveBlockToDB(block); err != nil {
-			return err
+	// Validate and apply each new block in sequence
+	for i := fork; i < len(newBlocks); i++ {
+		if err := bc.connectBlock(view, newBlocks[:i], newBlocks[i]); err != nil {
+			return fmt.Errorf("block %d invalid: %v", i, err)
 		}
 	}
 
-	bc.Blocks = newBlocks
+	if err := view.commit(); err != nil {
+		return err
+	}
+
+	bc.Blocks = append(bc.Blocks[:fork:fork], newBlocks[fork:]...)
 	return nil
 }
 
@@ -140,12 +186,14 @@ func (b *Block) CalculateHash() string {
 		Timestamp    int64
 		Nonce        int
 		PrevHash     string
+		Bits         uint32
 		Transactions []Transaction
 	}{
 		Index:        b.Index,
 		Timestamp:    b.Timestamp,
 		Nonce:        b.Nonce,
 		PrevHash:     b.PrevHash,
+		Bits:         b.Bits,
 		Transactions: b.Transactions,
 	})
 	h := sha256.Sum256(data)
@@ -153,102 +201,295 @@ func (b *Block) CalculateHash() string {
 }
 
 func (bc *Blockchain) AddBlock(newBlock *Block) error {
-	if err := bc.ValidateBlock(newBlock); err != nil {
+	view := newStateView(bc.db)
+	if err := bc.connectBlock(view, bc.Blocks, newBlock); err != nil {
 		return err
 	}
-
-	bc.Blocks = append(bc.Blocks, newBlock)
-	if err := bc.saveBlockToDB(newBlock); err != nil {
+	if err := view.commit(); err != nil {
 		return err
 	}
 
+	bc.Blocks = append(bc.Blocks, newBlock)
 	return nil
 }
 
 // ValidateBlock checks:
+// - Index follows the latest block
 // - Previous hash matches latest block
-// - Hash matches difficulty
+// - Bits follow the retarget schedule and the hash meets them
+// - Timestamp is not before the latest block nor far in the future
+// - A single coinbase comes first and mints at most subsidy plus fees
+// - Signatures valid on all non-reward transactions, signed for this chain
+// - Nonces follow on from the last tx of each sender
 // - Balances sufficient
-// - And signatures valid on all non-reward transactions
+// - And name operations follow the registry rules
 func (bc *Blockchain) ValidateBlock(block *Block) error {
+	return bc.connectBlock(newStateView(bc.db), bc.Blocks, block)
+}
+
+// connectBlock validates block on top of chain, whose state is held by view,
+// and stages the block together with its state changes and undo record.
+func (bc *Blockchain) connectBlock(view *stateView, chain []*Block, block *Block) error {
 	hash := block.CalculateHash()
 	if hash != block.Hash {
 		return errors.New("block hash mismatch")
 	}
 
-	if hash[:4] != "0000" {
+	if block.Index != len(chain) {
+		return fmt.Errorf("block index %d does not follow chain height %d", block.Index, len(chain)-1)
+	}
+	if block.PrevHash != chain[len(chain)-1].Hash {
+		return errors.New("block does not link to the latest block")
+	}
+
+	if bits := NextBits(chain); block.Bits != bits {
+		return fmt.Errorf("block bits %08x, expected %08x", block.Bits, bits)
+	}
+	if !MeetsTarget(hash, block.Bits) {
 		return errors.New("block does not meet difficulty")
 	}
 
-	// Prepare balances snapshot
-	balanceCache := make(map[string]float64)
-	for _, b := range bc.Blocks {
-		for _, tx := range b.Transactions {
-			balanceCache[tx.From] -= tx.Price + tx.Fee
-			balanceCache[tx.To] += tx.Price
-		}
+	if block.Timestamp < chain[len(chain)-1].Timestamp {
+		return errors.New("block timestamp is before its parent")
+	}
+	if block.Timestamp > time.Now().Unix()+MaxFutureBlockSeconds {
+		return errors.New("block timestamp is too far in the future")
+	}
+
+	supply, err := view.supplyCounters()
+	if err != nil {
+		return err
+	}
+	if err := checkCoinbase(block, supply.Issued); err != nil {
+		return err
+	}
+
+	state := view.child()
+	if err := NewRegistry(state).beginBlock(block.Index); err != nil {
+		return err
 	}
 
 	// Validate transactions
-	for _, tx := range block.Transactions {
-		// Reward tx: From "nebula" can skip signature check
-		if tx.Type == TxTransfer && tx.From == "nebula" {
-			continue
+	for i, tx := range block.Transactions {
+		// The coinbase is the only tx without a signature
+		if i > 0 {
+			if err := bc.checkChainID(tx); err != nil {
+				return err
+			}
+			addr, err := RecoverAddressFromTransaction(tx)
+			if err != nil {
+				return fmt.Errorf("signature invalid on tx from %s: %w", tx.From, err)
+			}
+			if addr != tx.From {
+				return fmt.Errorf("signature does not match sender address %s", tx.From)
+			}
 		}
 
-		// Check signature
-		addr, err := RecoverAddressFromTransaction(tx)
-		if err != nil {
-			return fmt.Errorf("signature invalid on tx from %s: %w", tx.From, err)
-		}
-		if addr != tx.From {
-			return fmt.Errorf("signature does not match sender address %s", tx.From)
+		// Check balance and name ownership rules
+		if err := applyTx(state, tx, block.Index); err != nil {
+			return fmt.Errorf("invalid %s tx from %s: %w", tx.Type, tx.From, err)
 		}
+	}
 
-		// Check balance
-		if balanceCache[tx.From] < tx.Price+tx.Fee {
-			return fmt.Errorf("insufficient funds for %s", tx.From)
-		}
+	if err := state.issue(block); err != nil {
+		return err
+	}
+	return stageBlock(view, state, block)
+}
+
+// applyBlock stages a block that is already part of the chain.
+// Transactions the state rules reject are skipped, so blocks accepted
+// before the rules were enforced can still be replayed.
+func (bc *Blockchain) applyBlock(view *stateView, block *Block) error {
+	state := view.child()
+	if err := NewRegistry(state).beginBlock(block.Index); err != nil {
+		return err
+	}
+	for _, tx := range block.Transactions {
+		_ = applyTx(state, tx, block.Index)
+	}
+	if err := state.issue(block); err != nil {
+		return err
+	}
+	return stageBlock(view, state, block)
+}
 
-		balanceCache[tx.From] -= tx.Price + tx.Fee
-		balanceCache[tx.To] += tx.Price
+// stageBlock merges the state changes of block into view and stages the
+// block itself along with the undo record that reverts those changes.
+func stageBlock(view, state *stateView, block *Block) error {
+	if err := state.put(stateHeightKey, block.Index); err != nil {
+		return err
 	}
+	undo, err := state.undo()
+	if err != nil {
+		return err
+	}
+	state.merge()
 
-	return nil
+	if err := view.put(undoKey(block.Index), undo); err != nil {
+		return err
+	}
+	return view.put(blockKey(block.Index), block)
 }
 
-func (bc *Blockchain) GetBalance(addr string) float64 {
-	var balance float64 = 0
-	for _, block := range bc.Blocks {
-		for _, tx := range block.Transactions {
-			if tx.From == addr {
-				balance -= tx.Price + tx.Fee
-			}
-			if tx.To == addr {
-				balance += tx.Price
-			}
-		}
+// ValidateTx checks tx against the state as it would stand once the
+// pending transactions are mined on top of the chain.
+func (bc *Blockchain) ValidateTx(tx Transaction, pending []Transaction) error {
+	if err := bc.checkChainID(tx); err != nil {
+		return err
 	}
-	return balance
+	view := bc.pendingState(pending)
+	return applyTx(view, tx, bc.Height())
 }
 
-func (bc *Blockchain) GetBalanceWithPending(addr string, pending []Transaction) float64 {
-	balance := bc.GetBalance(addr)
+// checkChainID rejects tx if it was signed for another network.
+func (bc *Blockchain) checkChainID(tx Transaction) error {
+	if tx.ChainID != bc.ChainID {
+		return fmt.Errorf("tx from %s is for chain %q, not %q", tx.From, tx.ChainID, bc.ChainID)
+	}
+	return nil
+}
+
+// pendingState returns a view of the state as the next block would find
+// it, with pending applied on top.
+func (bc *Blockchain) pendingState(pending []Transaction) *stateView {
+	view := newStateView(bc.db)
+	if err := NewRegistry(view).beginBlock(bc.Height()); err != nil {
+		log.Printf("[ERROR] Failed to begin block %d: %v\n", bc.Height(), err)
+	}
 	for _, tx := range pending {
-		if tx.From == addr {
-			balance -= tx.Price + tx.Fee
+		_ = applyTx(view, tx, bc.Height())
+	}
+	return view
+}
+
+// NextNonce returns the nonce the next tx from addr must carry once the
+// pending transactions are mined.
+func (bc *Blockchain) NextNonce(addr string, pending []Transaction) (uint64, error) {
+	return bc.pendingState(pending).nonce(addr)
+}
+
+// LookupName returns the current registry entry for name.
+func (bc *Blockchain) LookupName(name string) (NameEntry, bool, error) {
+	return NewRegistry(newStateView(bc.db)).Lookup(name)
+}
+
+// NameHistory returns every mined event on name, oldest first.
+func (bc *Blockchain) NameHistory(name string) ([]NameEvent, error) {
+	return NewRegistry(newStateView(bc.db)).History(name)
+}
+
+// Offers returns the open offers on name.
+func (bc *Blockchain) Offers(name string) ([]Offer, error) {
+	return NewRegistry(newStateView(bc.db)).Offers(name)
+}
+
+// LookupAuction returns the running auction for name, if any.
+func (bc *Blockchain) LookupAuction(name string) (Auction, bool, error) {
+	return NewRegistry(newStateView(bc.db)).LookupAuction(name)
+}
+
+// ResolveName returns the entry for name only while its lease is active.
+func (bc *Blockchain) ResolveName(name string) (NameEntry, bool, error) {
+	entry, found, err := bc.LookupName(name)
+	if err != nil || !found || entry.Status(bc.Height()) != NameActive {
+		return NameEntry{}, false, err
+	}
+	return entry, true, nil
+}
+
+// PrimaryName returns the name addr has set as its primary name, as long
+// as it still owns it.
+func (bc *Blockchain) PrimaryName(addr string) (string, bool, error) {
+	return NewRegistry(newStateView(bc.db)).PrimaryName(addr, bc.Height())
+}
+
+// NamesByOwner returns every name owned by addr that has not expired
+// past its grace period.
+func (bc *Blockchain) NamesByOwner(addr string) ([]NameEntry, error) {
+	return bc.names(func(entry NameEntry) bool {
+		return entry.Owner == addr && entry.Status(bc.Height()) != NameExpired
+	})
+}
+
+// ActiveNames returns every name whose lease is active, in name order.
+func (bc *Blockchain) ActiveNames() ([]NameEntry, error) {
+	return bc.names(func(entry NameEntry) bool {
+		return entry.Status(bc.Height()) == NameActive
+	})
+}
+
+// names returns the registered names that keep accepts.
+func (bc *Blockchain) names(keep func(NameEntry) bool) ([]NameEntry, error) {
+	iter := bc.db.NewIterator(util.BytesPrefix([]byte(nameKeyPrefix)), nil)
+	defer iter.Release()
+
+	registry := NewRegistry(newStateView(bc.db))
+	names := []NameEntry{}
+	for iter.Next() {
+		var stored NameEntry
+		if err := json.Unmarshal(iter.Value(), &stored); err != nil {
+			return nil, err
 		}
-		if tx.To == addr {
-			balance += tx.Price
+		entry, found, err := registry.Lookup(stored.Name)
+		if err != nil {
+			return nil, err
+		}
+		if found && keep(entry) {
+			names = append(names, entry)
 		}
 	}
+	return names, iter.Error()
+}
+
+// ResolvedPayee returns the address a mined tx paid when it was sent to a
+// name or bought one.
+func (bc *Blockchain) ResolvedPayee(hash string) (string, bool, error) {
+	var payee string
+	found, err := newStateView(bc.db).get(payeeKey(hash), &payee)
+	return payee, found, err
+}
+
+func (bc *Blockchain) GetBalance(addr string) float64 {
+	return bc.GetBalanceWithPending(addr, nil)
+}
+
+func (bc *Blockchain) GetBalanceWithPending(addr string, pending []Transaction) float64 {
+	balance, err := bc.pendingState(pending).balance(addr)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read balance of %s: %v\n", addr, err)
+	}
 	return balance
 }
 
+// Supply reports the coin supply as of the latest block.
+func (bc *Blockchain) Supply() (Supply, error) {
+	view := newStateView(bc.db)
+	counters, err := view.supplyCounters()
+	if err != nil {
+		return Supply{}, err
+	}
+	return Supply{
+		Height:      bc.Height(),
+		Circulating: counters.Issued - counters.Burned,
+		Issued:      counters.Issued,
+		Burned:      counters.Burned,
+		Remaining:   MaxSupply - counters.Issued,
+		MaxSupply:   MaxSupply,
+		NextSubsidy: BlockSubsidy(bc.Height(), counters.Issued),
+	}, nil
+}
+
 func (bc *Blockchain) GetLatestBlock() *Block {
 	return bc.Blocks[len(bc.Blocks)-1]
 }
 
+// Height returns the index of the next block, at which pending
+// transactions and name leases are evaluated.
+func (bc *Blockchain) Height() int {
+	return bc.GetLatestBlock().Index + 1
+}
+
 func (bc *Blockchain) Close() error {
 	return bc.db.Close()
 }
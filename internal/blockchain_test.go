@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testChainID = "nebula-test"
+
+func newTestChain(t *testing.T) *Blockchain {
+	t.Helper()
+	bc, err := NewBlockchain(filepath.Join(t.TempDir(), "chain"), testChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.db.Close() })
+	return bc
+}
+
+func newTestWallet(t *testing.T) *Wallet {
+	t.Helper()
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// mineBlock mines the block following chain, opening with a coinbase
+// that pays the subsidy and fees to miner.
+func mineBlock(t *testing.T, chain []*Block, issued float64, miner string, txs ...Transaction) *Block {
+	t.Helper()
+	tip := chain[len(chain)-1]
+	coinbase := Transaction{
+		Type:  TxTransfer,
+		From:  "nebula",
+		To:    miner,
+		Price: BlockSubsidy(tip.Index+1, issued) + BlockFees(txs),
+	}
+	block := &Block{
+		Index:        tip.Index + 1,
+		Timestamp:    max(time.Now().Unix(), tip.Timestamp),
+		Transactions: append([]Transaction{coinbase}, txs...),
+		PrevHash:     tip.Hash,
+		Bits:         NextBits(chain),
+	}
+	for {
+		hash := block.CalculateHash()
+		if MeetsTarget(hash, block.Bits) {
+			block.Hash = hash
+			return block
+		}
+		block.Nonce++
+	}
+}
+
+// addBlock mines the next block of bc and adds it.
+func addBlock(t *testing.T, bc *Blockchain, miner string, txs ...Transaction) *Block {
+	t.Helper()
+	supply, err := bc.Supply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := mineBlock(t, bc.Blocks, supply.Issued, miner, txs...)
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func signTx(t *testing.T, bc *Blockchain, w *Wallet, tx Transaction) Transaction {
+	t.Helper()
+	tx.ChainID = bc.ChainID
+	tx.From = w.Address
+	nonce, err := bc.NextNonce(w.Address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Nonce = nonce
+	if err := SignTransaction(&tx, w.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestReplaceChainRevertsState(t *testing.T) {
+	bc := newTestChain(t)
+	alice, bob, carol := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+
+	addBlock(t, bc, alice.Address)
+	before, err := bc.Supply()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice pays Bob, then commits to and registers a name
+	name, salt := "reorgtest", "0123456789abcdef"
+	addBlock(t, bc, alice.Address,
+		signTx(t, bc, alice, Transaction{Type: TxTransfer, To: bob.Address, Price: 10, Fee: 1}))
+	addBlock(t, bc, alice.Address,
+		signTx(t, bc, alice, Transaction{Type: TxCommit, Fee: 1, Commitment: Commitment(name, salt, alice.Address)}))
+	addBlock(t, bc, alice.Address,
+		signTx(t, bc, alice, Transaction{Type: TxRegister, To: "nebula", Name: name, Price: NamePrice(name), Fee: 1, Salt: salt}))
+	if _, found, err := bc.LookupName(name); err != nil || !found {
+		t.Fatalf("name not registered before the reorg: %v", err)
+	}
+
+	// A longer fork from block 1 in which only Carol mines
+	fork := append([]*Block{}, bc.Blocks[:2]...)
+	issued := before.Issued
+	for len(fork) <= len(bc.Blocks) {
+		block := mineBlock(t, fork, issued, carol.Address)
+		issued += block.Transactions[0].Price
+		fork = append(fork, block)
+	}
+	if err := bc.ReplaceChain(fork); err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.Blocks) != len(fork) || bc.GetLatestBlock().Hash != fork[len(fork)-1].Hash {
+		t.Fatal("chain was not replaced")
+	}
+
+	if got := bc.GetBalance(alice.Address); got != InitialSubsidy {
+		t.Errorf("alice balance %v, want %v", got, InitialSubsidy)
+	}
+	if got := bc.GetBalance(bob.Address); got != 0 {
+		t.Errorf("bob balance %v, want 0", got)
+	}
+	if got, want := bc.GetBalance(carol.Address), InitialSubsidy*float64(len(fork)-2); got != want {
+		t.Errorf("carol balance %v, want %v", got, want)
+	}
+	if nonce, err := bc.NextNonce(alice.Address, nil); err != nil || nonce != 0 {
+		t.Errorf("alice nonce %d, want 0 (%v)", nonce, err)
+	}
+	if _, found, err := bc.LookupName(name); err != nil || found {
+		t.Errorf("name survived the reorg (%v)", err)
+	}
+	after, err := bc.Supply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Issued != issued || after.Burned != before.Burned {
+		t.Errorf("supply %+v, want issued %v and burned %v", after, issued, before.Burned)
+	}
+
+	// The commitment was reverted too, so Alice can make it again
+	tx := signTx(t, bc, alice, Transaction{Type: TxCommit, Fee: 1, Commitment: Commitment(name, salt, alice.Address)})
+	if err := bc.ValidateTx(tx, nil); err != nil {
+		t.Errorf("commitment still pending after the reorg: %v", err)
+	}
+}
+
+func TestReplaceChainRejectsOtherGenesis(t *testing.T) {
+	bc := newTestChain(t)
+	miner := newTestWallet(t)
+	tip := addBlock(t, bc, miner.Address)
+
+	other := *bc.Blocks[0]
+	other.Timestamp++
+	other.Hash = other.CalculateHash()
+	fork := []*Block{&other}
+	for len(fork) <= len(bc.Blocks) {
+		fork = append(fork, mineBlock(t, fork, 0, miner.Address))
+	}
+	if err := bc.ReplaceChain(fork); err == nil {
+		t.Fatal("accepted a chain with a different genesis block")
+	}
+	if len(bc.Blocks) != 2 || bc.GetLatestBlock().Hash != tip.Hash {
+		t.Fatal("chain changed")
+	}
+}
+
+func TestAddBlockRejectsUnlinkedBlock(t *testing.T) {
+	bc := newTestChain(t)
+	miner := newTestWallet(t)
+	addBlock(t, bc, miner.Address)
+
+	// A block at the right height whose parent is not our tip
+	other := *bc.GetLatestBlock()
+	other.Hash = "00"
+	chain := append(bc.Blocks[:len(bc.Blocks)-1:len(bc.Blocks)-1], &other)
+	supply, err := bc.Supply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := mineBlock(t, chain, supply.Issued, miner.Address)
+	if err := bc.AddBlock(block); err == nil {
+		t.Fatal("accepted a block that does not link to the tip")
+	}
+	if len(bc.Blocks) != 2 {
+		t.Fatal("chain changed")
+	}
+}
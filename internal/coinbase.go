@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// IsCoinbase reports whether tx is a block reward, the only transaction
+// that may spend from "nebula".
+func IsCoinbase(tx Transaction) bool {
+	return tx.Type == TxTransfer && tx.From == "nebula"
+}
+
+// BlockFees returns the total fee paid by the transactions of a block,
+// which its coinbase may claim on top of the subsidy.
+func BlockFees(txs []Transaction) float64 {
+	fees := float64(0)
+	for _, tx := range txs {
+		if !IsCoinbase(tx) {
+			fees += tx.Fee
+		}
+	}
+	return fees
+}
+
+// checkCoinbase requires block to open with a single coinbase paying at
+// most the subsidy plus the fees of the block, given the coins issued
+// before it. No fee may be negative. The genesis block is exempt.
+func checkCoinbase(block *Block, issued float64) error {
+	if block.Index == 0 {
+		return nil
+	}
+	if len(block.Transactions) == 0 || !IsCoinbase(block.Transactions[0]) {
+		return errors.New("block must start with a coinbase")
+	}
+	for _, tx := range block.Transactions[1:] {
+		if tx.From == "nebula" {
+			return errors.New("block has more than one coinbase")
+		}
+		if tx.Fee < 0 {
+			return fmt.Errorf("tx from %s has a negative fee", tx.From)
+		}
+	}
+
+	coinbase := block.Transactions[0]
+	if !IsAddress(coinbase.To) {
+		return fmt.Errorf("coinbase pays invalid address %q", coinbase.To)
+	}
+	if coinbase.Fee != 0 || coinbase.Price < 0 {
+		return errors.New("coinbase must have no fee and a non-negative amount")
+	}
+	if limit := BlockSubsidy(block.Index, issued) + BlockFees(block.Transactions); coinbase.Price > limit {
+		return fmt.Errorf("coinbase %.10f exceeds subsidy plus fees %.10f", coinbase.Price, limit)
+	}
+	return nil
+}
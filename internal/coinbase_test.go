@@ -0,0 +1,37 @@
+package internal
+
+import "testing"
+
+func TestCheckCoinbase(t *testing.T) {
+	const miner = "1879fc84e4469a624a82f8d786f5dfef9b65a712"
+	coinbase := func(amount float64) Transaction {
+		return Transaction{Type: TxTransfer, From: "nebula", To: miner, Price: amount}
+	}
+	transfer := Transaction{Type: TxTransfer, From: miner, To: miner, Price: 1, Fee: 2}
+
+	tests := []struct {
+		name  string
+		index int
+		txs   []Transaction
+		ok    bool
+	}{
+		{"subsidy plus fees", 1, []Transaction{coinbase(InitialSubsidy + 2), transfer}, true},
+		{"less than allowed", 1, []Transaction{coinbase(0), transfer}, true},
+		{"genesis is exempt", 0, []Transaction{coinbase(1000)}, true},
+		{"missing coinbase", 1, nil, false},
+		{"coinbase not first", 1, []Transaction{transfer, coinbase(InitialSubsidy)}, false},
+		{"second coinbase", 1, []Transaction{coinbase(InitialSubsidy), coinbase(1)}, false},
+		{"over subsidy plus fees", 1, []Transaction{coinbase(InitialSubsidy + 3), transfer}, false},
+		{"negative fee", 1, []Transaction{coinbase(InitialSubsidy - 5), {Type: TxTransfer, From: miner, To: miner, Fee: -5}}, false},
+		{"pays a name", 1, []Transaction{{Type: TxTransfer, From: "nebula", To: "example", Price: 1}}, false},
+		{"pays nebula", 1, []Transaction{{Type: TxTransfer, From: "nebula", To: "nebula", Price: 1}}, false},
+		{"coinbase fee", 1, []Transaction{{Type: TxTransfer, From: "nebula", To: miner, Price: 1, Fee: 1}}, false},
+		{"negative coinbase", 1, []Transaction{coinbase(-1)}, false},
+	}
+	for _, tt := range tests {
+		err := checkCoinbase(&Block{Index: tt.index, Transactions: tt.txs}, 0)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
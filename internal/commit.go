@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	// MinCommitAge is how many blocks must separate a COMMIT from the
+	// REGISTER that reveals it.
+	MinCommitAge = 1
+	// MaxCommitAge is the last block, counted from the COMMIT, in which
+	// the REGISTER may land.
+	MaxCommitAge = 100
+	// MinSaltLength keeps commitments to common names from being guessed.
+	MinSaltLength = 16
+)
+
+const commitKeyPrefix = "commit-"
+
+// commitKey keys commitments by sender, so copying a pending commitment
+// from another address cannot block its owner.
+func commitKey(from, commitment string) string {
+	return commitKeyPrefix + from + "-" + commitment
+}
+
+// commitEntry records when a registration commitment was mined.
+type commitEntry struct {
+	Height int `json:"height"`
+}
+
+// Commitment returns the hash a COMMIT publishes ahead of the REGISTER of
+// name by addr, which reveals salt.
+func Commitment(name, salt, addr string) string {
+	h := sha256.Sum256([]byte(name + "\x00" + salt + "\x00" + addr))
+	return hex.EncodeToString(h[:])
+}
+
+// commit records the commitment carried by a COMMIT tx.
+func (r *Registry) commit(tx Transaction, height int) error {
+	if tx.Name != "" {
+		return errors.New("commit must not reveal the name")
+	}
+	if b, err := hex.DecodeString(tx.Commitment); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("invalid commitment %q", tx.Commitment)
+	}
+
+	var existing commitEntry
+	found, err := r.state.get(commitKey(tx.From, tx.Commitment), &existing)
+	if err != nil {
+		return err
+	}
+	if found && height-existing.Height <= MaxCommitAge {
+		return errors.New("commitment already pending")
+	}
+	return r.state.put(commitKey(tx.From, tx.Commitment), commitEntry{Height: height})
+}
+
+// reveal consumes the commitment matching a REGISTER tx, which must land
+// within the reveal window of its COMMIT, and returns the height the
+// commitment was mined at.
+func (r *Registry) reveal(tx Transaction, height int) (int, error) {
+	if len(tx.Salt) < MinSaltLength {
+		return 0, fmt.Errorf("salt must be at least %d characters", MinSaltLength)
+	}
+
+	key := commitKey(tx.From, Commitment(tx.Name, tx.Salt, tx.From))
+	var c commitEntry
+	found, err := r.state.get(key, &c)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("no commitment for %q from %s", tx.Name, tx.From)
+	}
+	if age := height - c.Height; age < MinCommitAge {
+		return 0, errors.New("commitment is not mined yet")
+	} else if age > MaxCommitAge {
+		return 0, fmt.Errorf("commitment expired %d blocks ago", age-MaxCommitAge)
+	}
+
+	r.state.delete(key)
+	return c.Height, nil
+}
@@ -7,10 +7,21 @@ import (
 	"os"
 )
 
+// DefaultChainID is the chain ID of the main Nebula network.
+const DefaultChainID = "nebula-mainnet"
+
 type Config struct {
 	Port           int
 	DBPath         string
 	BootstrapPeers []string
+	// DNSListen is the UDP/TCP address of the built-in DNS server;
+	// empty disables it.
+	DNSListen string
+	// DNSZone is the suffix under which registered names are served.
+	DNSZone string
+	// ChainID names the network. Transactions are only valid on the
+	// network they were signed for.
+	ChainID string
 }
 
 func LoadConfig(path string) (Config, error) {
@@ -29,8 +40,10 @@ func LoadConfig(path string) (Config, error) {
 
 func DefaultConfig() Config {
 	cfg := Config{
-		Port:   8080,
-		DBPath: "data/blockchain",
+		Port:    8080,
+		DBPath:  "data/blockchain",
+		DNSZone: ".nebula",
+		ChainID: DefaultChainID,
 	}
 	if len(cfg.BootstrapPeers) == 0 {
 		for port := 8000; port <= 8999; port++ {
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// parentName splits a subdomain such as "api.team" into its parent "team".
+func parentName(name string) (string, bool) {
+	_, parent, ok := strings.Cut(name, ".")
+	return parent, ok
+}
+
+// delegate creates the subdomain named by tx under a parent owned by its
+// sender, handing it to tx.To.
+func (r *Registry) delegate(tx Transaction, entry NameEntry, exists bool, height int) (NameEntry, error) {
+	parentName, ok := parentName(tx.Name)
+	if !ok || strings.HasPrefix(tx.Name, ".") {
+		return NameEntry{}, fmt.Errorf("%q is not a subdomain", tx.Name)
+	}
+	parent, found, err := r.Lookup(parentName)
+	if err != nil {
+		return NameEntry{}, err
+	}
+	if err := checkOwner(parent, found, Transaction{Name: parentName, From: tx.From}, height); err != nil {
+		return NameEntry{}, err
+	}
+	if exists {
+		return NameEntry{}, fmt.Errorf("subdomain %q is already delegated", tx.Name)
+	}
+	if !IsAddress(tx.To) {
+		return NameEntry{}, fmt.Errorf("invalid recipient address %q", tx.To)
+	}
+
+	return NameEntry{
+		Name:               tx.Name,
+		Owner:              tx.To,
+		Records:            []Record{},
+		Parent:             parentName,
+		ParentRegisteredAt: parent.RegisteredAt,
+		Revocable:          tx.Revocable,
+		RegisteredAt:       height,
+		ExpiresAt:          parent.ExpiresAt,
+	}, nil
+}
+
+// revoke removes a revocable subdomain on behalf of its parent's owner.
+func (r *Registry) revoke(tx Transaction, entry NameEntry, exists bool, height int) error {
+	if !exists || entry.Parent == "" {
+		return fmt.Errorf("subdomain %q is not delegated", tx.Name)
+	}
+	parent, found, err := r.Lookup(entry.Parent)
+	if err != nil {
+		return err
+	}
+	if err := checkOwner(parent, found, Transaction{Name: entry.Parent, From: tx.From}, height); err != nil {
+		return err
+	}
+	if !entry.Revocable {
+		return errors.New("delegation is not revocable")
+	}
+	r.state.delete(nameKey(tx.Name))
+	return r.clearPrimary(entry.Owner, tx.Name)
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"fmt"
+)
+
+const depositExpiryKeyPrefix = "deposit-expiry-"
+
+func depositExpiryKey(height int) string {
+	return fmt.Sprintf("%s%09d", depositExpiryKeyPrefix, height)
+}
+
+// beginBlock applies the effects due at height before the transactions of
+// the block at that height: lapsed offers and the deposits of names that
+// expired are refunded.
+func (r *Registry) beginBlock(height int) error {
+	if err := r.expireOffers(height); err != nil {
+		return err
+	}
+	return r.expireDeposits(height)
+}
+
+// scheduleRefund arranges for the deposit of entry to be refunded once it
+// expires past its grace period.
+func (r *Registry) scheduleRefund(entry NameEntry) error {
+	key := depositExpiryKey(entry.ExpiresAt + NameGraceBlocks)
+	var names []string
+	if _, err := r.state.get(key, &names); err != nil {
+		return err
+	}
+	return r.state.put(key, append(names, entry.Name))
+}
+
+// refundDeposit returns the deposit held for entry to its owner.
+func (r *Registry) refundDeposit(entry *NameEntry) error {
+	if err := r.state.debit(EscrowAddress, entry.Deposit); err != nil {
+		return err
+	}
+	if err := r.state.credit(entry.Owner, entry.Deposit); err != nil {
+		return err
+	}
+	entry.Deposit = 0
+	return nil
+}
+
+// expireDeposits refunds the deposits of names expiring at height. Names
+// renewed since they were scheduled are left for their new expiry.
+func (r *Registry) expireDeposits(height int) error {
+	var names []string
+	found, err := r.state.get(depositExpiryKey(height), &names)
+	if err != nil || !found {
+		return err
+	}
+
+	for _, name := range names {
+		entry, exists, err := r.Lookup(name)
+		if err != nil {
+			return err
+		}
+		if !exists || entry.Deposit == 0 || entry.ExpiresAt+NameGraceBlocks != height {
+			continue
+		}
+		if err := r.refundDeposit(&entry); err != nil {
+			return err
+		}
+		if err := r.state.put(nameKey(name), entry); err != nil {
+			return err
+		}
+	}
+	r.state.delete(depositExpiryKey(height))
+	return nil
+}
+
+// release gives a name up before it expires, refunding its deposit.
+func (r *Registry) release(tx Transaction, entry NameEntry, exists bool, height int) error {
+	if !exists || entry.Status(height) == NameExpired {
+		return fmt.Errorf("name %q is not registered", tx.Name)
+	}
+	if entry.Owner != tx.From {
+		return fmt.Errorf("%s does not own %q", tx.From, tx.Name)
+	}
+	if err := r.refundDeposit(&entry); err != nil {
+		return err
+	}
+	r.state.delete(nameKey(tx.Name))
+	return r.clearPrimary(tx.From, tx.Name)
+}
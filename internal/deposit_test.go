@@ -0,0 +1,37 @@
+package internal
+
+import "testing"
+
+func TestDepositRefundedOnTransfer(t *testing.T) {
+	bc := newTestChain(t)
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	addBlock(t, bc, alice.Address)
+
+	name := "deposited"
+	addBlock(t, bc, alice.Address, commitTx(t, bc, alice, name))
+	register := signTx(t, bc, alice, Transaction{
+		Type: TxRegister, To: EscrowAddress, Name: name, Price: NamePrice(name), Fee: 1, Salt: testSalt,
+	})
+	addBlock(t, bc, bob.Address, register)
+	if got := bc.GetBalance(EscrowAddress); got != NamePrice(name) {
+		t.Fatalf("escrow holds %v, want %v", got, NamePrice(name))
+	}
+	aliceBalance := bc.GetBalance(alice.Address)
+
+	addBlock(t, bc, bob.Address,
+		signTx(t, bc, alice, Transaction{Type: TxTransferName, To: bob.Address, Name: name, Fee: 1}))
+
+	entry, found, err := bc.LookupName(name)
+	if err != nil || !found || entry.Owner != bob.Address {
+		t.Fatalf("name not transferred: %+v (%v)", entry, err)
+	}
+	if entry.Deposit != 0 {
+		t.Errorf("deposit %v followed the name", entry.Deposit)
+	}
+	if got, want := bc.GetBalance(alice.Address), aliceBalance-1+NamePrice(name); got != want {
+		t.Errorf("alice balance %v, want %v", got, want)
+	}
+	if got := bc.GetBalance(EscrowAddress); got != 0 {
+		t.Errorf("escrow holds %v after transfer", got)
+	}
+}
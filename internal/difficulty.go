@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"math/big"
+)
+
+const (
+	// TargetBlockSeconds is the block time retargeting aims for.
+	TargetBlockSeconds = 60
+	// RetargetInterval is the number of blocks between retargets, and the
+	// number of block times each retarget measures.
+	RetargetInterval = 20
+	// MaxRetargetFactor bounds how far one retarget can move the target.
+	MaxRetargetFactor = 4
+	// MaxFutureBlockSeconds is how far ahead of the local clock a block
+	// timestamp may be.
+	MaxFutureBlockSeconds = 2 * 60 * 60
+)
+
+var (
+	// InitialBits is the target of the first blocks: a hash below 2^240,
+	// i.e. four leading zero hex digits.
+	InitialBits = BigToCompact(new(big.Int).Lsh(big.NewInt(1), 240))
+	// powLimit is the easiest target retargeting may reach.
+	powLimit = new(big.Int).Lsh(big.NewInt(1), 244)
+)
+
+// CompactToBig expands a target in the compact form of Block.Bits: the
+// high byte is a length in bytes and the low three bytes the mantissa.
+func CompactToBig(bits uint32) *big.Int {
+	mantissa := int64(bits & 0x007fffff)
+	size := uint(bits >> 24)
+
+	target := big.NewInt(mantissa)
+	if size <= 3 {
+		target.Rsh(target, 8*(3-size))
+	} else {
+		target.Lsh(target, 8*(size-3))
+	}
+	if bits&0x00800000 != 0 {
+		target.Neg(target)
+	}
+	return target
+}
+
+// BigToCompact encodes a non-negative target in compact form.
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+
+	size := uint32(len(target.Bytes()))
+	var mantissa uint32
+	if size <= 3 {
+		mantissa = uint32(target.Uint64()) << (8 * (3 - size))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(target, uint(8*(size-3))).Uint64())
+	}
+	// The sign bit of the mantissa must stay clear
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+	return size<<24 | mantissa
+}
+
+// MeetsTarget reports whether the hex block hash is at or below the target
+// encoded by bits.
+func MeetsTarget(hash string, bits uint32) bool {
+	h, ok := new(big.Int).SetString(hash, 16)
+	if !ok {
+		return false
+	}
+	target := CompactToBig(bits)
+	return target.Sign() > 0 && h.Cmp(target) <= 0
+}
+
+// NextBits returns the target the block following chain must meet. Every
+// RetargetInterval blocks the target is scaled by how long the last
+// RetargetInterval blocks took against TargetBlockSeconds each, by at most
+// MaxRetargetFactor either way.
+func NextBits(chain []*Block) uint32 {
+	height := len(chain)
+	prev := chain[height-1]
+	bits := prev.Bits
+	if bits == 0 {
+		bits = InitialBits
+	}
+
+	// The genesis timestamp says nothing about block times
+	if height%RetargetInterval != 0 || height-1-RetargetInterval < 1 {
+		return bits
+	}
+
+	first := chain[height-1-RetargetInterval]
+	expected := int64(RetargetInterval * TargetBlockSeconds)
+	actual := prev.Timestamp - first.Timestamp
+	actual = max(actual, expected/MaxRetargetFactor)
+	actual = min(actual, expected*MaxRetargetFactor)
+
+	target := CompactToBig(bits)
+	target.Mul(target, big.NewInt(actual))
+	target.Div(target, big.NewInt(expected))
+	if target.Cmp(powLimit) > 0 {
+		target.Set(powLimit)
+	}
+	return BigToCompact(target)
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestCompactRoundTrip(t *testing.T) {
+	tests := []struct {
+		target int64
+		bits   uint32
+	}{
+		{0, 0},
+		{1, 0x01010000},
+		{0x7f, 0x017f0000},
+		// A mantissa with its top bit set is shifted into the next byte
+		{0x80, 0x02008000},
+		{0xffff, 0x0300ffff},
+		{0x123456, 0x03123456},
+		{0x800000, 0x04008000},
+	}
+	for _, tt := range tests {
+		target := big.NewInt(tt.target)
+		if got := BigToCompact(target); got != tt.bits {
+			t.Errorf("BigToCompact(%#x) = %#08x, want %#08x", tt.target, got, tt.bits)
+		}
+		if got := CompactToBig(tt.bits); got.Cmp(target) != 0 {
+			t.Errorf("CompactToBig(%#08x) = %#x, want %#x", tt.bits, got, tt.target)
+		}
+	}
+
+	// Large targets keep their top three bytes
+	target, _ := new(big.Int).SetString("123456789abcdef", 16)
+	want, _ := new(big.Int).SetString("123450000000000", 16)
+	if got := CompactToBig(BigToCompact(target)); got.Cmp(want) != 0 {
+		t.Errorf("round trip of %x = %x, want %x", target, got, want)
+	}
+
+	if CompactToBig(0x04800001).Sign() >= 0 {
+		t.Error("sign bit not decoded")
+	}
+}
+
+func TestInitialBitsMatchesFourZeroDigits(t *testing.T) {
+	if want := new(big.Int).Lsh(big.NewInt(1), 240); CompactToBig(InitialBits).Cmp(want) != 0 {
+		t.Fatalf("initial target %x, want 2^240", CompactToBig(InitialBits))
+	}
+	tests := []struct {
+		hash string
+		ok   bool
+	}{
+		{"0000" + strings.Repeat("f", 60), true},
+		{strings.Repeat("0", 64), true},
+		{"0001" + strings.Repeat("0", 59) + "1", false},
+		{"000f" + strings.Repeat("0", 60), false},
+		{"f" + strings.Repeat("0", 63), false},
+		{"not a hash", false},
+	}
+	for _, tt := range tests {
+		if got := MeetsTarget(tt.hash, InitialBits); got != tt.ok {
+			t.Errorf("MeetsTarget(%s) = %v, want %v", tt.hash, got, tt.ok)
+		}
+	}
+	if MeetsTarget(strings.Repeat("0", 64), 0) {
+		t.Error("zero target met")
+	}
+}
+
+// retargetChain returns a chain of height blocks at bits, spaced by
+// spacing seconds after the genesis block.
+func retargetChain(height int, bits uint32, spacing int64) []*Block {
+	chain := []*Block{{Index: 0, Timestamp: -22082082, Bits: InitialBits}}
+	for i := 1; i < height; i++ {
+		chain = append(chain, &Block{Index: i, Timestamp: int64(i) * spacing, Bits: bits})
+	}
+	return chain
+}
+
+func TestNextBits(t *testing.T) {
+	initial := CompactToBig(InitialBits)
+	scaled := func(num, den int64) uint32 {
+		target := new(big.Int).Mul(initial, big.NewInt(num))
+		return BigToCompact(target.Div(target, big.NewInt(den)))
+	}
+	retarget := 2 * RetargetInterval
+
+	tests := []struct {
+		name    string
+		height  int
+		bits    uint32
+		spacing int64
+		want    uint32
+	}{
+		{"on schedule", retarget, InitialBits, TargetBlockSeconds, InitialBits},
+		{"twice as fast", retarget, InitialBits, TargetBlockSeconds / 2, scaled(1, 2)},
+		{"twice as slow", retarget, InitialBits, 2 * TargetBlockSeconds, scaled(2, 1)},
+		{"clamped fast", retarget, InitialBits, 1, scaled(1, MaxRetargetFactor)},
+		{"clamped slow", retarget, InitialBits, 100 * TargetBlockSeconds, scaled(MaxRetargetFactor, 1)},
+		{"capped at the limit", retarget, BigToCompact(powLimit), 100 * TargetBlockSeconds, BigToCompact(powLimit)},
+		{"between retargets", retarget - 1, InitialBits, 1, InitialBits},
+		{"window includes genesis", RetargetInterval, InitialBits, 1, InitialBits},
+		{"legacy parent", 5, 0, 1, InitialBits},
+	}
+	for _, tt := range tests {
+		if got := NextBits(retargetChain(tt.height, tt.bits, tt.spacing)); got != tt.want {
+			t.Errorf("%s: NextBits = %#08x, want %#08x", tt.name, got, tt.want)
+		}
+	}
+}
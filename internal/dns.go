@@ -0,0 +1,312 @@
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultDNSTTL is the TTL, in seconds, of answers served from the registry.
+const DefaultDNSTTL = 300
+
+const (
+	// maxUDPMessage is the largest UDP answer to a client without EDNS.
+	maxUDPMessage = 512
+	// ednsUDPSize is the largest UDP answer sent to any client, whatever
+	// buffer it advertises, and the size the server advertises itself.
+	ednsUDPSize = 1232
+)
+
+// NameLookup resolves a registry name to its current entry.
+type NameLookup func(name string) (NameEntry, bool, error)
+
+// DNSServer answers queries for the records of registered names under a zone,
+// e.g. "example.nebula." for the name "example".
+type DNSServer struct {
+	zone   string
+	lookup NameLookup
+}
+
+func NewDNSServer(zone string, lookup NameLookup) *DNSServer {
+	return &DNSServer{zone: ZoneOrigin(zone), lookup: lookup}
+}
+
+// ListenAndServe serves DNS on addr over both UDP and TCP until either
+// listener fails.
+func (s *DNSServer) ListenAndServe(addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	errc := make(chan error, 2)
+	go func() { errc <- s.ServeUDP(pc) }()
+	go func() { errc <- s.ServeTCP(ln) }()
+	return <-errc
+}
+
+// ServeUDP answers queries read from conn until it is closed.
+func (s *DNSServer) ServeUDP(conn net.PacketConn) error {
+	buf := make([]byte, ednsUDPSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		resp, err := s.answer(buf[:n], true)
+		if err != nil {
+			continue
+		}
+		_, _ = conn.WriteTo(resp, addr)
+	}
+}
+
+// ServeTCP answers length-prefixed queries on connections accepted from ln
+// until it is closed.
+func (s *DNSServer) ServeTCP(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *DNSServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	var length [2]byte
+	for {
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		resp, err := s.Answer(query)
+		if err != nil {
+			return
+		}
+		binary.BigEndian.PutUint16(length[:], uint16(len(resp)))
+		if _, err := conn.Write(append(length[:], resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// Answer builds the wire-format response to a wire-format query received
+// over a stream, where the response size is not limited.
+func (s *DNSServer) Answer(query []byte) ([]byte, error) {
+	return s.answer(query, false)
+}
+
+// answer builds the response to query. Over UDP a response that does not
+// fit the buffer of the client is sent without answers and with the TC bit
+// set, so the client retries over TCP.
+func (s *DNSServer) answer(query []byte, udp bool) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	if header.Response {
+		// Never answer responses, which could loop between servers
+		return nil, errors.New("dns message is not a query")
+	}
+
+	respHeader := dnsmessage.Header{
+		ID:                 header.ID,
+		Response:           true,
+		OpCode:             header.OpCode,
+		Authoritative:      true,
+		RecursionDesired:   header.RecursionDesired,
+		RecursionAvailable: false,
+	}
+
+	q, err := p.Question()
+	if err != nil {
+		respHeader.RCode = dnsmessage.RCodeFormatError
+		return s.build(respHeader, nil, nil, false)
+	}
+	bufSize := ednsBufferSize(&p)
+	edns := bufSize > 0
+	if header.OpCode != 0 {
+		respHeader.RCode = dnsmessage.RCodeNotImplemented
+		return s.build(respHeader, &q, nil, edns)
+	}
+
+	answers, rcode := s.resolve(q)
+	respHeader.RCode = rcode
+	resp, err := s.build(respHeader, &q, answers, edns)
+	if err != nil || !udp || len(resp) <= min(max(bufSize, maxUDPMessage), ednsUDPSize) {
+		return resp, err
+	}
+	respHeader.Truncated = true
+	return s.build(respHeader, &q, nil, edns)
+}
+
+// ednsBufferSize returns the UDP buffer size a query advertises in its
+// EDNS OPT record, or 0 if it has none. p must be past the question.
+func ednsBufferSize(p *dnsmessage.Parser) int {
+	if p.SkipAllQuestions() != nil || p.SkipAllAnswers() != nil || p.SkipAllAuthorities() != nil {
+		return 0
+	}
+	for {
+		h, err := p.AdditionalHeader()
+		if err != nil {
+			return 0
+		}
+		if h.Type == dnsmessage.TypeOPT {
+			return int(h.Class)
+		}
+		if err := p.SkipAdditional(); err != nil {
+			return 0
+		}
+	}
+}
+
+// resolve looks up the records answering q in the registry.
+func (s *DNSServer) resolve(q dnsmessage.Question) ([]dnsmessage.Resource, dnsmessage.RCode) {
+	qname := strings.ToLower(q.Name.String())
+	if qname == s.zone {
+		return nil, dnsmessage.RCodeSuccess
+	}
+	name, ok := strings.CutSuffix(qname, "."+s.zone)
+	if !ok {
+		return nil, dnsmessage.RCodeRefused
+	}
+
+	entry, found, err := s.lookup(name)
+	if err != nil {
+		return nil, dnsmessage.RCodeServerFailure
+	}
+	if !found {
+		return nil, dnsmessage.RCodeNameError
+	}
+
+	var answers []dnsmessage.Resource
+	for _, r := range entry.Records {
+		rtype := recordTypes[r.Type]
+		if rtype != q.Type && r.Type != RecordCNAME {
+			continue
+		}
+		body, err := recordBody(r)
+		if err != nil {
+			return nil, dnsmessage.RCodeServerFailure
+		}
+		answers = append(answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: rtype, Class: dnsmessage.ClassINET, TTL: r.TTL},
+			Body:   body,
+		})
+	}
+	return answers, dnsmessage.RCodeSuccess
+}
+
+var recordTypes = map[string]dnsmessage.Type{
+	RecordA:     dnsmessage.TypeA,
+	RecordAAAA:  dnsmessage.TypeAAAA,
+	RecordCNAME: dnsmessage.TypeCNAME,
+	RecordTXT:   dnsmessage.TypeTXT,
+	RecordMX:    dnsmessage.TypeMX,
+	RecordSRV:   dnsmessage.TypeSRV,
+}
+
+// recordBody converts a registry record to its DNS resource body.
+func recordBody(r Record) (dnsmessage.ResourceBody, error) {
+	switch r.Type {
+	case RecordA:
+		var a dnsmessage.AResource
+		copy(a.A[:], net.ParseIP(r.Value).To4())
+		return &a, nil
+	case RecordAAAA:
+		var aaaa dnsmessage.AAAAResource
+		copy(aaaa.AAAA[:], net.ParseIP(r.Value).To16())
+		return &aaaa, nil
+	case RecordTXT:
+		return &dnsmessage.TXTResource{TXT: []string{r.Value}}, nil
+	}
+
+	target, err := dnsmessage.NewName(fqdn(r.Value))
+	if err != nil {
+		return nil, err
+	}
+	switch r.Type {
+	case RecordCNAME:
+		return &dnsmessage.CNAMEResource{CNAME: target}, nil
+	case RecordMX:
+		return &dnsmessage.MXResource{Pref: r.Priority, MX: target}, nil
+	case RecordSRV:
+		return &dnsmessage.SRVResource{Priority: r.Priority, Weight: r.Weight, Port: r.Port, Target: target}, nil
+	}
+	return nil, fmt.Errorf("unsupported record type %q", r.Type)
+}
+
+func fqdn(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
+
+// build encodes a response, with an OPT record if the query used EDNS.
+func (s *DNSServer) build(header dnsmessage.Header, q *dnsmessage.Question, answers []dnsmessage.Resource, edns bool) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), header)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if q != nil {
+		if err := b.Question(*q); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	for _, rr := range answers {
+		var err error
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			err = b.AResource(rr.Header, *body)
+		case *dnsmessage.AAAAResource:
+			err = b.AAAAResource(rr.Header, *body)
+		case *dnsmessage.CNAMEResource:
+			err = b.CNAMEResource(rr.Header, *body)
+		case *dnsmessage.TXTResource:
+			err = b.TXTResource(rr.Header, *body)
+		case *dnsmessage.MXResource:
+			err = b.MXResource(rr.Header, *body)
+		case *dnsmessage.SRVResource:
+			err = b.SRVResource(rr.Header, *body)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if edns {
+		var opt dnsmessage.ResourceHeader
+		if err := opt.SetEDNS0(ednsUDPSize, dnsmessage.RCodeSuccess, false); err != nil {
+			return nil, err
+		}
+		if err := b.StartAdditionals(); err != nil {
+			return nil, err
+		}
+		if err := b.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
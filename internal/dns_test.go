@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func testDNSServer() *DNSServer {
+	txt := make([]Record, MaxRecords)
+	for i := range txt {
+		txt[i] = Record{Type: RecordTXT, Value: strings.Repeat("x", MaxTXTLength), TTL: DefaultDNSTTL}
+	}
+	entries := map[string]NameEntry{
+		"small": {Name: "small", Records: []Record{{Type: RecordA, Value: "192.0.2.1", TTL: DefaultDNSTTL}}},
+		"large": {Name: "large", Records: txt},
+	}
+	return NewDNSServer("nebula", func(name string) (NameEntry, bool, error) {
+		entry, ok := entries[name]
+		return entry, ok, nil
+	})
+}
+
+func dnsQuery(t *testing.T, name string, qtype dnsmessage.Type, edns int) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 7, RecursionDesired: true})
+	if err := b.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  qtype,
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if edns > 0 {
+		var opt dnsmessage.ResourceHeader
+		if err := opt.SetEDNS0(edns, dnsmessage.RCodeSuccess, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.StartAdditionals(); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query
+}
+
+func exchangeUDP(t *testing.T, conn net.Conn, query []byte) ([]byte, error) {
+	t.Helper()
+	if _, err := conn.Write(query); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, maxDNSMessage)
+	n, err := conn.Read(buf)
+	return buf[:n], err
+}
+
+func parseResponse(t *testing.T, resp []byte) (dnsmessage.Message, int) {
+	t.Helper()
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		t.Fatal(err)
+	}
+	return msg, len(msg.Answers)
+}
+
+func TestDNSServerUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go testDNSServer().ServeUDP(pc)
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	resp, err := exchangeUDP(t, conn, dnsQuery(t, "small.nebula.", dnsmessage.TypeA, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, answers := parseResponse(t, resp)
+	if msg.ID != 7 || msg.Truncated || answers != 1 {
+		t.Fatalf("small answer: id %d, truncated %v, %d answers", msg.ID, msg.Truncated, answers)
+	}
+
+	for _, edns := range []int{0, 4096} {
+		resp, err := exchangeUDP(t, conn, dnsQuery(t, "large.nebula.", dnsmessage.TypeTXT, edns))
+		if err != nil {
+			t.Fatal(err)
+		}
+		limit := maxUDPMessage
+		if edns > 0 {
+			limit = ednsUDPSize
+		}
+		if len(resp) > limit {
+			t.Fatalf("edns %d: %d byte answer exceeds %d", edns, len(resp), limit)
+		}
+		msg, answers := parseResponse(t, resp)
+		if !msg.Truncated || answers != 0 {
+			t.Fatalf("edns %d: truncated %v, %d answers", edns, msg.Truncated, answers)
+		}
+	}
+
+	// A response must not be answered
+	reply := dnsQuery(t, "small.nebula.", dnsmessage.TypeA, 0)
+	reply[2] |= 0x80
+	if resp, err := exchangeUDP(t, conn, reply); err == nil {
+		t.Fatalf("answered a response with %d bytes", len(resp))
+	}
+}
+
+func TestDNSServerTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go testDNSServer().ServeTCP(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	query := dnsQuery(t, "large.nebula.", dnsmessage.TypeTXT, 0)
+	msg := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := conn.Write(append(msg, query...)); err != nil {
+		t.Fatal(err)
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		t.Fatal(err)
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		t.Fatal(err)
+	}
+
+	got, answers := parseResponse(t, resp)
+	if got.Truncated || answers != MaxRecords {
+		t.Fatalf("truncated %v, %d answers, want %d", got.Truncated, answers, MaxRecords)
+	}
+}
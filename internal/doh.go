@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSMessageType is the media type of wire-format DNS messages.
+const DNSMessageType = "application/dns-message"
+
+// maxDNSMessage is the largest message DNS over TCP or HTTPS can carry.
+const maxDNSMessage = 65535
+
+// ServeHTTP answers RFC 8484 DNS-over-HTTPS queries, sent either as the
+// base64url "dns" parameter of a GET or as the body of a POST.
+func (s *DNSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var query []byte
+	switch r.Method {
+	case http.MethodGet:
+		param := r.URL.Query().Get("dns")
+		if param == "" {
+			http.Error(w, "missing dns parameter", http.StatusBadRequest)
+			return
+		}
+		var err error
+		query, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(param, "="))
+		if err != nil {
+			http.Error(w, "invalid dns parameter", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != DNSMessageType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		var err error
+		query, err = io.ReadAll(io.LimitReader(r.Body, maxDNSMessage+1))
+		if err != nil {
+			http.Error(w, "failed to read query", http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(query) == 0 || len(query) > maxDNSMessage {
+		http.Error(w, "invalid query size", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.Answer(query)
+	if err != nil {
+		http.Error(w, "malformed dns query", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", DNSMessageType)
+	if ttl, ok := minTTL(resp); ok {
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(ttl), 10))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp)))
+	w.Write(resp)
+}
+
+// minTTL returns the smallest TTL among the answers of resp, which bounds
+// how long an HTTP cache may keep it.
+func minTTL(resp []byte) (uint32, bool) {
+	var p dnsmessage.Parser
+	if _, err := p.Start(resp); err != nil {
+		return 0, false
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return 0, false
+	}
+
+	var ttl uint32
+	found := false
+	for {
+		h, err := p.AnswerHeader()
+		if err != nil {
+			break
+		}
+		if !found || h.TTL < ttl {
+			ttl, found = h.TTL, true
+		}
+		if err := p.SkipAnswer(); err != nil {
+			break
+		}
+	}
+	return ttl, found
+}
@@ -0,0 +1,49 @@
+package internal
+
+const historyKeyPrefix = "history-"
+
+func historyKey(name string) string {
+	return historyKeyPrefix + name
+}
+
+// NameEvent is a mined tx that acted on a name, along with its owner once
+// the tx was applied.
+type NameEvent struct {
+	Block int     `json:"block"`
+	Tx    string  `json:"tx"`
+	Type  string  `json:"type"`
+	From  string  `json:"from"`
+	To    string  `json:"to,omitempty"`
+	Owner string  `json:"owner,omitempty"`
+	Price float64 `json:"price,omitempty"`
+}
+
+// History returns every event recorded for name, oldest first.
+func (r *Registry) History(name string) ([]NameEvent, error) {
+	events := []NameEvent{}
+	_, err := r.state.get(historyKey(name), &events)
+	return events, err
+}
+
+// record appends tx to the history of the name it acted on.
+func (r *Registry) record(tx Transaction, height int) error {
+	events, err := r.History(tx.Name)
+	if err != nil {
+		return err
+	}
+	var entry NameEntry
+	if _, err := r.state.get(nameKey(tx.Name), &entry); err != nil {
+		return err
+	}
+
+	events = append(events, NameEvent{
+		Block: height,
+		Tx:    tx.Hash(),
+		Type:  tx.Type,
+		From:  tx.From,
+		To:    tx.To,
+		Owner: entry.Owner,
+		Price: tx.Price,
+	})
+	return r.state.put(historyKey(tx.Name), events)
+}
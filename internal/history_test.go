@@ -0,0 +1,22 @@
+package internal
+
+import "testing"
+
+func TestHistoryIgnoresNonNameTxs(t *testing.T) {
+	bc := newTestChain(t)
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	addBlock(t, bc, alice.Address)
+
+	tx := signTx(t, bc, alice, Transaction{Type: TxTransfer, To: bob.Address, Name: "google", Price: 1, Fee: 1})
+	if err := bc.ValidateTx(tx, nil); err == nil {
+		t.Fatal("accepted a TRANSFER carrying a name")
+	}
+
+	history, err := bc.NameHistory("google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("history of an unregistered name has %d events", len(history))
+	}
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	acctKeyPrefix  = "acct-"
+	nonceKeyPrefix = "nonce-"
+	payeeKeyPrefix = "payee-"
+)
+
+func acctKey(addr string) string {
+	return acctKeyPrefix + addr
+}
+
+func nonceKey(addr string) string {
+	return nonceKeyPrefix + addr
+}
+
+func payeeKey(hash string) string {
+	return payeeKeyPrefix + hash
+}
+
+// balance returns the balance of addr in the state.
+func (v *stateView) balance(addr string) (float64, error) {
+	var bal float64
+	_, err := v.get(acctKey(addr), &bal)
+	return bal, err
+}
+
+// credit gives amount to addr. Coins credited to "nebula" are burned.
+func (v *stateView) credit(addr string, amount float64) error {
+	if amount < 0 {
+		return fmt.Errorf("cannot credit negative amount %.10f", amount)
+	}
+	if amount == 0 {
+		return nil
+	}
+	bal, err := v.balance(addr)
+	if err != nil {
+		return err
+	}
+	if addr == "nebula" {
+		if err := v.burn(amount); err != nil {
+			return err
+		}
+	}
+	return v.put(acctKey(addr), bal+amount)
+}
+
+// debit takes amount from addr. Only the "nebula" issuer may go negative.
+func (v *stateView) debit(addr string, amount float64) error {
+	if amount < 0 {
+		return fmt.Errorf("cannot debit negative amount %.10f", amount)
+	}
+	if amount == 0 {
+		return nil
+	}
+	bal, err := v.balance(addr)
+	if err != nil {
+		return err
+	}
+	if addr != "nebula" && bal < amount {
+		return fmt.Errorf("insufficient funds for %s", addr)
+	}
+	return v.put(acctKey(addr), bal-amount)
+}
+
+// nonce returns the nonce the next tx from addr must carry.
+func (v *stateView) nonce(addr string) (uint64, error) {
+	var n uint64
+	_, err := v.get(nonceKey(addr), &n)
+	return n, err
+}
+
+// useNonce accepts n as the nonce of the next tx from addr, so that no
+// signed tx can be applied twice.
+func (v *stateView) useNonce(addr string, n uint64) error {
+	next, err := v.nonce(addr)
+	if err != nil {
+		return err
+	}
+	if n != next {
+		return fmt.Errorf("nonce %d from %s is not the expected %d", n, addr, next)
+	}
+	return v.put(nonceKey(addr), next+1)
+}
+
+// applyTx applies every effect of tx at height to view: its nonce, the
+// fee, the value it moves and its name operation. A rejected tx leaves view untouched.
+func applyTx(view *stateView, tx Transaction, height int) error {
+	if tx.Price < 0 || tx.Fee < 0 {
+		return errors.New("tx price and fee must not be negative")
+	}
+
+	state := view.child()
+	registry := NewRegistry(state)
+
+	if !IsCoinbase(tx) {
+		if err := state.useNonce(tx.From, tx.Nonce); err != nil {
+			return err
+		}
+	}
+
+	payee, err := payeeOf(registry, tx, height)
+	if err != nil {
+		return err
+	}
+	if payee != tx.To {
+		// Record who a name resolved to, as its owner may change later
+		if err := state.put(payeeKey(tx.Hash()), payee); err != nil {
+			return err
+		}
+	}
+
+	if err := state.debit(tx.From, tx.Cost()); err != nil {
+		return err
+	}
+	if err := state.credit(payee, tx.Amount()); err != nil {
+		return err
+	}
+	if err := registry.ApplyTx(tx, height); err != nil {
+		return err
+	}
+
+	state.merge()
+	return nil
+}
+
+// payeeOf returns the account credited by tx at height. A BUY pays
+// whoever owns the name when it is mined, and a TRANSFER to a name pays
+// the owner it resolves to.
+func payeeOf(registry *Registry, tx Transaction, height int) (string, error) {
+	switch {
+	case tx.Type == TxBuy:
+		entry, found, err := registry.Lookup(tx.Name)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "", fmt.Errorf("name %q is not registered", tx.Name)
+		}
+		return entry.Owner, nil
+
+	case tx.Type == TxTransfer && !IsAddress(tx.To) && tx.To != "nebula" && tx.To != EscrowAddress:
+		entry, found, err := registry.Lookup(tx.To)
+		if err != nil {
+			return "", err
+		}
+		if !found || entry.Status(height) != NameActive {
+			return "", fmt.Errorf("recipient %q is not an address or registered name", tx.To)
+		}
+		return entry.Owner, nil
+	}
+	return tx.To, nil
+}
@@ -0,0 +1,26 @@
+package internal
+
+import "testing"
+
+func TestValidateTxRejectsInvalidTransfers(t *testing.T) {
+	bc := newTestChain(t)
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	addBlock(t, bc, alice.Address)
+
+	tests := map[string]Transaction{
+		"unknown type":   {Type: "WHATEVER", To: bob.Address, Price: 1, Fee: 1},
+		"negative price": {Type: TxTransfer, To: bob.Address, Price: -5, Fee: 1},
+		"negative fee":   {Type: TxTransfer, To: bob.Address, Price: 1, Fee: -5},
+		"overspend":      {Type: TxTransfer, To: bob.Address, Price: InitialSubsidy, Fee: 1},
+	}
+	for name, tx := range tests {
+		if err := bc.ValidateTx(signTx(t, bc, alice, tx), nil); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	ok := signTx(t, bc, alice, Transaction{Type: TxTransfer, To: bob.Address, Price: 10, Fee: 1})
+	if err := bc.ValidateTx(ok, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"fmt"
+)
+
+const (
+	// MaxLockBlocks bounds how far ahead a single LOCK can freeze a name.
+	MaxLockBlocks = NameLeaseBlocks
+	// UnlockDelayBlocks is how long an UNLOCK takes to lift a lock, so a
+	// stolen key cannot free a name and move it at once.
+	UnlockDelayBlocks = 1000
+)
+
+// Locked reports whether the name is frozen against changing hands at
+// height.
+func (e NameEntry) Locked(height int) bool {
+	return height < e.LockedUntil
+}
+
+// lock freezes the name for tx.Blocks blocks. A lock can be extended but
+// never shortened this way.
+func lock(tx Transaction, entry *NameEntry, exists bool, height int) error {
+	if err := checkOwner(*entry, exists, tx, height); err != nil {
+		return err
+	}
+	if tx.Blocks <= 0 || tx.Blocks > MaxLockBlocks {
+		return fmt.Errorf("lock must last 1 to %d blocks", MaxLockBlocks)
+	}
+	entry.LockedUntil = max(entry.LockedUntil, height+tx.Blocks)
+	return nil
+}
+
+// unlock lifts the lock on a name once UnlockDelayBlocks have passed.
+func unlock(tx Transaction, entry *NameEntry, exists bool, height int) error {
+	if err := checkOwner(*entry, exists, tx, height); err != nil {
+		return err
+	}
+	if !entry.Locked(height) {
+		return fmt.Errorf("name %q is not locked", tx.Name)
+	}
+	entry.LockedUntil = min(entry.LockedUntil, height+UnlockDelayBlocks)
+	return nil
+}
+
+// checkUnlocked rejects tx if it would move a locked name.
+func checkUnlocked(tx Transaction, entry NameEntry, height int) error {
+	switch tx.Type {
+	case TxSell, TxBuy, TxTransferName, TxAcceptName, TxAcceptOffer, TxRelease:
+	default:
+		return nil
+	}
+	if entry.Locked(height) {
+		return fmt.Errorf("name %q is locked until block %d", tx.Name, entry.LockedUntil)
+	}
+	return nil
+}
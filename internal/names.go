@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	MaxLabelLength = 63
+	MaxNameLength  = 253
+)
+
+// ReservedNames cannot be registered. Some would shadow the system
+// accounts a TRANSFER can pay, the rest are reserved for DNS use.
+var ReservedNames = map[string]bool{
+	"nebula":    true,
+	"escrow":    true,
+	"localhost": true,
+	"invalid":   true,
+	"test":      true,
+	"example":   true,
+	"local":     true,
+	"www":       true,
+	"admin":     true,
+	"root":      true,
+}
+
+// namePrices is the registration price by label length in characters,
+// for lengths 1 to 4. Longer labels cost BaseNamePrice.
+var namePrices = []float64{500, 250, 100, 50}
+
+// BaseNamePrice is the registration price of a name of five or more
+// characters.
+const BaseNamePrice = float64(10)
+
+// NormalizeName returns the canonical form of name: lowercase, with every
+// non-ASCII label in punycode.
+func NormalizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("empty name")
+	}
+	ascii, err := idna.Lookup.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid name %q: %v", name, err)
+	}
+	if err := checkName(ascii); err != nil {
+		return "", err
+	}
+	return ascii, nil
+}
+
+// ValidateName rejects a name that is not in canonical form, so names
+// differing only in case or encoding cannot both be registered.
+func ValidateName(name string) error {
+	canonical, err := NormalizeName(name)
+	if err != nil {
+		return err
+	}
+	if canonical != name {
+		return fmt.Errorf("name %q is not canonical, use %q", name, canonical)
+	}
+	return nil
+}
+
+// NamePrice returns the price of registering name, which depends on the
+// length of its label.
+func NamePrice(name string) float64 {
+	label, err := idna.Lookup.ToUnicode(name)
+	if err != nil {
+		label = name
+	}
+	if n := utf8.RuneCountInString(label); n <= len(namePrices) {
+		return namePrices[max(n, 1)-1]
+	}
+	return BaseNamePrice
+}
+
+// checkName checks the length and character set of an ASCII name.
+func checkName(name string) error {
+	if len(name) > MaxNameLength {
+		return fmt.Errorf("name is longer than %d characters", MaxNameLength)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > MaxLabelLength {
+			return fmt.Errorf("label %q must be 1 to %d characters", label, MaxLabelLength)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("label %q cannot start or end with a hyphen", label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("label %q contains %q", label, c)
+			}
+		}
+		if strings.HasPrefix(label, "xn--") {
+			if err := checkScript(label); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// confusableScripts share enough lookalike letters that a label mixing
+// them is rejected.
+var confusableScripts = []string{"Latin", "Cyrillic", "Greek"}
+
+// checkScript rejects a punycode label whose letters mix confusable
+// scripts, the usual way of spelling a lookalike of another name.
+func checkScript(label string) error {
+	decoded, err := idna.Lookup.ToUnicode(label)
+	if err != nil {
+		return fmt.Errorf("invalid label %q: %v", label, err)
+	}
+
+	script := ""
+	for _, c := range decoded {
+		if !unicode.IsLetter(c) {
+			continue
+		}
+		s := scriptOf(c)
+		if s == "" {
+			continue
+		}
+		if script != "" && s != script {
+			return fmt.Errorf("label %q mixes %s and %s characters", decoded, script, s)
+		}
+		script = s
+	}
+	return nil
+}
+
+func scriptOf(c rune) string {
+	for _, name := range confusableScripts {
+		if unicode.Is(unicode.Scripts[name], c) {
+			return name
+		}
+	}
+	return ""
+}
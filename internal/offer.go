@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// MaxOfferBlocks bounds how long an offer keeps its escrow locked.
+	MaxOfferBlocks = 10000
+	// MaxOffersPerName bounds the number of open offers on one name.
+	MaxOffersPerName = 100
+)
+
+const (
+	offerKeyPrefix       = "offers-"
+	offerExpiryKeyPrefix = "offer-expiry-"
+)
+
+func offerKey(name string) string {
+	return offerKeyPrefix + name
+}
+
+func offerExpiryKey(height int) string {
+	return fmt.Sprintf("%s%09d", offerExpiryKeyPrefix, height)
+}
+
+// Offer is an escrowed bid by Buyer for a name, open until ExpiresAt.
+type Offer struct {
+	Buyer     string  `json:"buyer"`
+	Amount    float64 `json:"amount"`
+	MadeAt    int     `json:"made_at"`
+	ExpiresAt int     `json:"expires_at"`
+}
+
+// Offers returns the open offers on name.
+func (r *Registry) Offers(name string) ([]Offer, error) {
+	offers := []Offer{}
+	_, err := r.state.get(offerKey(name), &offers)
+	return offers, err
+}
+
+// offer records an offer on a registered name. The amount itself reaches
+// escrow as the value of the tx.
+func (r *Registry) offer(tx Transaction, entry NameEntry, exists bool, height int) error {
+	if !exists || entry.Status(height) != NameActive {
+		return fmt.Errorf("name %q is not registered", tx.Name)
+	}
+	if entry.Owner == tx.From {
+		return fmt.Errorf("%s already owns %q", tx.From, tx.Name)
+	}
+	if tx.To != EscrowAddress {
+		return errors.New("offer must be paid to escrow")
+	}
+	if tx.Price <= 0 {
+		return errors.New("offer must be positive")
+	}
+	if tx.ExpiresAt <= height || tx.ExpiresAt > height+MaxOfferBlocks {
+		return fmt.Errorf("offer must expire within %d blocks of height %d", MaxOfferBlocks, height)
+	}
+
+	offers, err := r.Offers(tx.Name)
+	if err != nil {
+		return err
+	}
+	if len(offers) >= MaxOffersPerName {
+		return fmt.Errorf("too many offers on %q", tx.Name)
+	}
+	for _, o := range offers {
+		if o.Buyer == tx.From {
+			return fmt.Errorf("%s already has an offer on %q", tx.From, tx.Name)
+		}
+	}
+	offers = append(offers, Offer{Buyer: tx.From, Amount: tx.Price, MadeAt: height, ExpiresAt: tx.ExpiresAt})
+	if err := r.state.put(offerKey(tx.Name), offers); err != nil {
+		return err
+	}
+
+	var expiring []string
+	if _, err := r.state.get(offerExpiryKey(tx.ExpiresAt), &expiring); err != nil {
+		return err
+	}
+	return r.state.put(offerExpiryKey(tx.ExpiresAt), append(expiring, tx.Name))
+}
+
+// acceptOffer sells the name to the buyer named by tx.To, paying the owner
+// from escrow.
+func (r *Registry) acceptOffer(tx Transaction, entry *NameEntry, exists bool, height int) error {
+	if err := checkOwner(*entry, exists, tx, height); err != nil {
+		return err
+	}
+	if tx.Price != 0 {
+		return errors.New("accepting an offer cannot move value")
+	}
+
+	offers, err := r.Offers(tx.Name)
+	if err != nil {
+		return err
+	}
+	for i, o := range offers {
+		if o.Buyer != tx.To {
+			continue
+		}
+		if height >= o.ExpiresAt {
+			break
+		}
+		if err := r.state.debit(EscrowAddress, o.Amount); err != nil {
+			return err
+		}
+		if err := r.state.credit(tx.From, o.Amount); err != nil {
+			return err
+		}
+		if err := r.putOffers(tx.Name, append(offers[:i:i], offers[i+1:]...)); err != nil {
+			return err
+		}
+		return r.setOwner(entry, o.Buyer)
+	}
+	return fmt.Errorf("no open offer from %s on %q", tx.To, tx.Name)
+}
+
+// expireOffers refunds every offer that lapses at height.
+func (r *Registry) expireOffers(height int) error {
+	var names []string
+	found, err := r.state.get(offerExpiryKey(height), &names)
+	if err != nil || !found {
+		return err
+	}
+
+	for _, name := range names {
+		offers, err := r.Offers(name)
+		if err != nil {
+			return err
+		}
+		open := offers[:0]
+		for _, o := range offers {
+			if o.ExpiresAt > height {
+				open = append(open, o)
+				continue
+			}
+			if err := r.state.debit(EscrowAddress, o.Amount); err != nil {
+				return err
+			}
+			if err := r.state.credit(o.Buyer, o.Amount); err != nil {
+				return err
+			}
+		}
+		if err := r.putOffers(name, open); err != nil {
+			return err
+		}
+	}
+	r.state.delete(offerExpiryKey(height))
+	return nil
+}
+
+func (r *Registry) putOffers(name string, offers []Offer) error {
+	if len(offers) == 0 {
+		r.state.delete(offerKey(name))
+		return nil
+	}
+	return r.state.put(offerKey(name), offers)
+}
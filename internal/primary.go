@@ -0,0 +1,52 @@
+package internal
+
+const primaryKeyPrefix = "primary-"
+
+func primaryKey(addr string) string {
+	return primaryKeyPrefix + addr
+}
+
+// setPrimary makes the name of tx the primary name of its sender, who must
+// own it. An empty name clears the primary name.
+func (r *Registry) setPrimary(tx Transaction, height int) error {
+	if tx.Name == "" {
+		r.state.delete(primaryKey(tx.From))
+		return nil
+	}
+
+	entry, exists, err := r.Lookup(tx.Name)
+	if err != nil {
+		return err
+	}
+	if err := checkOwner(entry, exists, tx, height); err != nil {
+		return err
+	}
+	return r.state.put(primaryKey(tx.From), tx.Name)
+}
+
+// clearPrimary drops the primary name of addr if it is name.
+func (r *Registry) clearPrimary(addr, name string) error {
+	var primary string
+	found, err := r.state.get(primaryKey(addr), &primary)
+	if err != nil || !found || primary != name {
+		return err
+	}
+	r.state.delete(primaryKey(addr))
+	return nil
+}
+
+// PrimaryName returns the primary name of addr while addr still owns it
+// and its lease is active at height.
+func (r *Registry) PrimaryName(addr string, height int) (string, bool, error) {
+	var name string
+	found, err := r.state.get(primaryKey(addr), &name)
+	if err != nil || !found {
+		return "", false, err
+	}
+
+	entry, exists, err := r.Lookup(name)
+	if err != nil || !exists || entry.Owner != addr || entry.Status(height) != NameActive {
+		return "", false, err
+	}
+	return name, true, nil
+}
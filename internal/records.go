@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	RecordA     = "A"
+	RecordAAAA  = "AAAA"
+	RecordCNAME = "CNAME"
+	RecordTXT   = "TXT"
+	RecordMX    = "MX"
+	RecordSRV   = "SRV"
+)
+
+const (
+	MaxRecords      = 32
+	MaxRecordTTL    = 86400
+	MaxTXTLength    = 255
+	MaxPayloadBytes = 256
+)
+
+// Record is a single DNS record attached to a name.
+type Record struct {
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	TTL      uint32 `json:"ttl"`
+	Priority uint16 `json:"priority,omitempty"`
+	Weight   uint16 `json:"weight,omitempty"`
+	Port     uint16 `json:"port,omitempty"`
+}
+
+// Validate checks the record against the schema of its type.
+func (r Record) Validate() error {
+	if r.TTL == 0 || r.TTL > MaxRecordTTL {
+		return fmt.Errorf("%s record ttl must be between 1 and %d", r.Type, MaxRecordTTL)
+	}
+
+	switch r.Type {
+	case RecordA:
+		if ip := net.ParseIP(r.Value); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("invalid A address %q", r.Value)
+		}
+	case RecordAAAA:
+		if ip := net.ParseIP(r.Value); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("invalid AAAA address %q", r.Value)
+		}
+	case RecordCNAME, RecordMX, RecordSRV:
+		if !validHostname(r.Value) {
+			return fmt.Errorf("invalid %s target %q", r.Type, r.Value)
+		}
+	case RecordTXT:
+		if r.Value == "" || len(r.Value) > MaxTXTLength {
+			return fmt.Errorf("TXT value must be 1 to %d bytes", MaxTXTLength)
+		}
+	default:
+		return fmt.Errorf("unsupported record type %q", r.Type)
+	}
+
+	if r.Type != RecordMX && r.Type != RecordSRV && r.Priority != 0 {
+		return fmt.Errorf("%s record cannot have a priority", r.Type)
+	}
+	if r.Type != RecordSRV && (r.Weight != 0 || r.Port != 0) {
+		return fmt.Errorf("%s record cannot have a weight or port", r.Type)
+	}
+	return nil
+}
+
+// ValidateRecords checks a complete record set for a name.
+func ValidateRecords(records []Record) error {
+	if len(records) > MaxRecords {
+		return fmt.Errorf("too many records: %d > %d", len(records), MaxRecords)
+	}
+	for _, r := range records {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		if r.Type == RecordCNAME && len(records) > 1 {
+			return errors.New("CNAME record cannot coexist with other records")
+		}
+	}
+	return nil
+}
+
+// checkPayload enforces the payload schema of tx. Only SET_IP carries a
+// payload ("ip" and an optional "ttl"), only SET_RECORDS carries records,
+// only SELL and OFFER carry an expiry, only COMMIT and BID carry a
+// commitment, only REGISTER and REVEAL_BID carry the salt that opens one,
+// only TRANSFER_NAME and LOCK carry a number of blocks and only DELEGATE
+// is revocable.
+func checkPayload(tx Transaction) error {
+	size := 0
+	for k, v := range tx.Payload {
+		size += len(k) + len(v)
+	}
+	if size > MaxPayloadBytes {
+		return fmt.Errorf("payload too large: %d > %d bytes", size, MaxPayloadBytes)
+	}
+
+	if !nameTxTypes[tx.Type] && tx.Type != TxSetPrimary && tx.Name != "" {
+		return fmt.Errorf("%s tx cannot carry a name", tx.Type)
+	}
+
+	if tx.Type != TxSell && tx.Type != TxOffer && tx.ExpiresAt != 0 {
+		return fmt.Errorf("%s tx cannot carry an expiry", tx.Type)
+	}
+
+	if tx.Type != TxTransferName && tx.Type != TxLock && tx.Blocks != 0 {
+		return fmt.Errorf("%s tx cannot carry a block window", tx.Type)
+	}
+
+	if tx.Type != TxDelegate && tx.Revocable {
+		return fmt.Errorf("%s tx cannot be revocable", tx.Type)
+	}
+
+	if tx.Type != TxCommit && tx.Type != TxBid && tx.Commitment != "" {
+		return fmt.Errorf("%s tx cannot carry a commitment", tx.Type)
+	}
+	if tx.Type != TxRegister && tx.Type != TxRevealBid && tx.Salt != "" {
+		return fmt.Errorf("%s tx cannot carry a salt", tx.Type)
+	}
+
+	if tx.Type != TxSetRecords && len(tx.Records) > 0 {
+		return fmt.Errorf("%s tx cannot carry records", tx.Type)
+	}
+
+	if tx.Type != TxSetIP {
+		if len(tx.Payload) > 0 {
+			return fmt.Errorf("%s tx cannot carry a payload", tx.Type)
+		}
+		return nil
+	}
+
+	for k := range tx.Payload {
+		if k != "ip" && k != "ttl" {
+			return fmt.Errorf("unknown payload field %q", k)
+		}
+	}
+	_, err := ipRecord(tx.Payload)
+	return err
+}
+
+// ipRecord turns a SET_IP payload into the A or AAAA record it sets.
+func ipRecord(payload map[string]string) (Record, error) {
+	ip := net.ParseIP(payload["ip"])
+	if ip == nil {
+		return Record{}, fmt.Errorf("invalid ip %q", payload["ip"])
+	}
+
+	r := Record{Type: RecordAAAA, Value: payload["ip"], TTL: DefaultDNSTTL}
+	if ip.To4() != nil {
+		r.Type = RecordA
+	}
+	if ttl, ok := payload["ttl"]; ok {
+		n, err := strconv.ParseUint(ttl, 10, 32)
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid ttl %q", ttl)
+		}
+		r.TTL = uint32(n)
+	}
+	return r, r.Validate()
+}
+
+// withAddress replaces the address records in records with r. Any CNAME is
+// dropped as well, since it cannot coexist with an address.
+func withAddress(records []Record, r Record) []Record {
+	updated := []Record{r}
+	for _, existing := range records {
+		switch existing.Type {
+		case RecordA, RecordAAAA, RecordCNAME:
+			continue
+		}
+		updated = append(updated, existing)
+	}
+	return updated
+}
+
+func validHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,406 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// NameLeaseBlocks is how long a registration or renewal lasts.
+	NameLeaseBlocks = 100000
+	// NameGraceBlocks is how long after expiry only the previous owner
+	// may renew a name before it can be registered again.
+	NameGraceBlocks = 10000
+	// RenewalFee is the minimum price of a RENEW, paid to nebula.
+	RenewalFee = float64(10)
+	// MaxAcceptBlocks bounds the window a two-step TRANSFER_NAME gives
+	// its recipient to ACCEPT_NAME.
+	MaxAcceptBlocks = 1000
+)
+
+const (
+	NameActive  = "active"
+	NameGrace   = "grace"
+	NameExpired = "expired"
+)
+
+// Listing is an open SELL offer on a name. A zero ExpiresAt never expires.
+type Listing struct {
+	Price     float64 `json:"price"`
+	ExpiresAt int     `json:"expires_at,omitempty"`
+}
+
+// Open reports whether the listing can still be bought at height.
+func (l *Listing) Open(height int) bool {
+	return l != nil && (l.ExpiresAt == 0 || height < l.ExpiresAt)
+}
+
+// PendingTransfer is a two-step transfer waiting for its recipient to
+// accept it before ExpiresAt.
+type PendingTransfer struct {
+	To        string `json:"to"`
+	ExpiresAt int    `json:"expires_at"`
+}
+
+// NameEntry is the registry state of a single name. A subdomain names
+// its Parent and shares the parent's lease. Deposit is the registration
+// price held in escrow, refunded to the owner on release, expiry or when
+// the name changes hands.
+type NameEntry struct {
+	Name               string           `json:"name"`
+	Owner              string           `json:"owner"`
+	Records            []Record         `json:"records"`
+	Listing            *Listing         `json:"listing,omitempty"`
+	PendingTransfer    *PendingTransfer `json:"pending_transfer,omitempty"`
+	Parent             string           `json:"parent,omitempty"`
+	ParentRegisteredAt int              `json:"parent_registered_at,omitempty"`
+	Revocable          bool             `json:"revocable,omitempty"`
+	Deposit            float64          `json:"deposit,omitempty"`
+	LockedUntil        int              `json:"locked_until,omitempty"`
+	RegisteredAt       int              `json:"registered_at"`
+	UpdatedAt          int              `json:"updated_at"`
+	ExpiresAt          int              `json:"expires_at"`
+}
+
+// setOwner hands entry to owner, refunding the deposit of the previous
+// owner and dropping any listing or pending transfer they made.
+func (r *Registry) setOwner(e *NameEntry, owner string) error {
+	if err := r.refundDeposit(e); err != nil {
+		return err
+	}
+	e.Owner = owner
+	e.Listing = nil
+	e.PendingTransfer = nil
+	return nil
+}
+
+// Status reports the lease state of the entry at the given height.
+func (e NameEntry) Status(height int) string {
+	switch {
+	case height < e.ExpiresAt:
+		return NameActive
+	case height < e.ExpiresAt+NameGraceBlocks:
+		return NameGrace
+	default:
+		return NameExpired
+	}
+}
+
+// Registry applies the name rules to the name-state table of a state view.
+type Registry struct {
+	state *stateView
+}
+
+func NewRegistry(state *stateView) *Registry {
+	return &Registry{state: state}
+}
+
+// Lookup returns the entry for name, if registered. A subdomain only
+// exists while the registration of its parent that delegated it does,
+// and takes its expiry from that parent.
+func (r *Registry) Lookup(name string) (NameEntry, bool, error) {
+	var entry NameEntry
+	found, err := r.state.get(nameKey(name), &entry)
+	if err != nil || !found || entry.Parent == "" {
+		return entry, found, err
+	}
+
+	parent, found, err := r.Lookup(entry.Parent)
+	if err != nil || !found || parent.RegisteredAt != entry.ParentRegisteredAt {
+		return NameEntry{}, false, err
+	}
+	entry.ExpiresAt = parent.ExpiresAt
+	return entry, true, nil
+}
+
+// ApplyTx applies the name effects of tx at the given block height.
+// Transactions that break the ownership rules are rejected and leave
+// the state untouched.
+func (r *Registry) ApplyTx(tx Transaction, height int) error {
+	pending := &Registry{state: r.state.child()}
+	if err := pending.apply(tx, height); err != nil {
+		return err
+	}
+	if nameTxTypes[tx.Type] {
+		if err := pending.record(tx, height); err != nil {
+			return err
+		}
+	}
+	pending.state.merge()
+	return nil
+}
+
+func (r *Registry) apply(tx Transaction, height int) error {
+	if err := checkPayload(tx); err != nil {
+		return err
+	}
+
+	switch tx.Type {
+	case TxTransfer:
+		return nil
+	case TxCommit:
+		return r.commit(tx, height)
+	case TxSetPrimary:
+		return r.setPrimary(tx, height)
+	}
+
+	if !nameTxTypes[tx.Type] {
+		return fmt.Errorf("unknown tx type %q", tx.Type)
+	}
+	if tx.Name == "" {
+		return errors.New("missing name")
+	}
+	if err := ValidateName(tx.Name); err != nil {
+		return err
+	}
+
+	entry, exists, err := r.Lookup(tx.Name)
+	if err != nil {
+		return err
+	}
+
+	if _, sub := parentName(tx.Name); sub {
+		switch tx.Type {
+		case TxRegister, TxRenew, TxSell, TxBuy, TxBid, TxRevealBid, TxSettleAuction,
+			TxOffer, TxAcceptOffer:
+			return fmt.Errorf("%s is not allowed on subdomain %q", tx.Type, tx.Name)
+		}
+	}
+
+	if exists {
+		if err := checkUnlocked(tx, entry, height); err != nil {
+			return err
+		}
+	}
+
+	prevOwner := entry.Owner
+
+	if (tx.Type == TxRegister || tx.Type == TxBid) && ReservedNames[tx.Name] {
+		return fmt.Errorf("name %q is reserved", tx.Name)
+	}
+
+	switch tx.Type {
+	case TxRegister:
+		if exists && entry.Status(height) != NameExpired {
+			return fmt.Errorf("name %q is already registered", tx.Name)
+		}
+		if tx.To != "nebula" && tx.To != EscrowAddress {
+			return errors.New("registration must be paid to nebula or held in escrow")
+		}
+		if price := NamePrice(tx.Name); tx.Price < price {
+			return fmt.Errorf("registration price %.10f is below %.10f", tx.Price, price)
+		}
+		committedAt, err := r.reveal(tx, height)
+		if err != nil {
+			return err
+		}
+		if a, running, err := r.LookupAuction(tx.Name); err != nil {
+			return err
+		} else if running {
+			// A bid cannot front-run a registration committed before it
+			if committedAt >= a.OpenedAt {
+				return fmt.Errorf("name %q is up for auction", tx.Name)
+			}
+			if err := r.cancelAuction(a); err != nil {
+				return err
+			}
+		}
+		entry = NameEntry{
+			Name:         tx.Name,
+			Owner:        tx.From,
+			Records:      []Record{},
+			RegisteredAt: height,
+			ExpiresAt:    height + NameLeaseBlocks,
+		}
+		if tx.To == EscrowAddress {
+			entry.Deposit = tx.Price
+			if err := r.scheduleRefund(entry); err != nil {
+				return err
+			}
+		}
+
+	case TxRenew:
+		if !exists || entry.Status(height) == NameExpired {
+			return fmt.Errorf("name %q is not registered", tx.Name)
+		}
+		if entry.Owner != tx.From {
+			return fmt.Errorf("%s does not own %q", tx.From, tx.Name)
+		}
+		if tx.To != "nebula" {
+			return errors.New("renewal must be paid to nebula")
+		}
+		if tx.Price < RenewalFee {
+			return fmt.Errorf("renewal fee %.10f is below %.10f", tx.Price, RenewalFee)
+		}
+		entry.ExpiresAt += NameLeaseBlocks
+		if entry.Deposit > 0 {
+			if err := r.scheduleRefund(entry); err != nil {
+				return err
+			}
+		}
+
+	case TxSetIP:
+		if err := checkOwner(entry, exists, tx, height); err != nil {
+			return err
+		}
+		record, err := ipRecord(tx.Payload)
+		if err != nil {
+			return err
+		}
+		records := withAddress(entry.Records, record)
+		if err := ValidateRecords(records); err != nil {
+			return err
+		}
+		entry.Records = records
+
+	case TxSetRecords:
+		if err := checkOwner(entry, exists, tx, height); err != nil {
+			return err
+		}
+		if err := ValidateRecords(tx.Records); err != nil {
+			return err
+		}
+		entry.Records = append([]Record{}, tx.Records...)
+
+	case TxSell:
+		if err := checkOwner(entry, exists, tx, height); err != nil {
+			return err
+		}
+		if tx.Price <= 0 {
+			return errors.New("listing price must be positive")
+		}
+		if tx.ExpiresAt != 0 && tx.ExpiresAt <= height {
+			return fmt.Errorf("listing expiry %d is not after height %d", tx.ExpiresAt, height)
+		}
+		entry.Listing = &Listing{Price: tx.Price, ExpiresAt: tx.ExpiresAt}
+
+	case TxCancelListing:
+		if err := checkOwner(entry, exists, tx, height); err != nil {
+			return err
+		}
+		if entry.Listing == nil {
+			return fmt.Errorf("name %q is not listed", tx.Name)
+		}
+		entry.Listing = nil
+
+	case TxBuy:
+		if !exists || entry.Status(height) != NameActive {
+			return fmt.Errorf("name %q is not registered", tx.Name)
+		}
+		if !entry.Listing.Open(height) {
+			return fmt.Errorf("name %q is not for sale", tx.Name)
+		}
+		if entry.Owner == tx.From {
+			return fmt.Errorf("%s already owns %q", tx.From, tx.Name)
+		}
+		if tx.Price < entry.Listing.Price {
+			return fmt.Errorf("offer %.10f is below listing price %.10f", tx.Price, entry.Listing.Price)
+		}
+		if err := r.setOwner(&entry, tx.From); err != nil {
+			return err
+		}
+
+	case TxOffer:
+		return r.offer(tx, entry, exists, height)
+
+	case TxAcceptOffer:
+		if err := r.acceptOffer(tx, &entry, exists, height); err != nil {
+			return err
+		}
+
+	case TxTransferName:
+		if err := checkOwner(entry, exists, tx, height); err != nil {
+			return err
+		}
+		if !IsAddress(tx.To) {
+			return fmt.Errorf("invalid recipient address %q", tx.To)
+		}
+		if tx.To == tx.From {
+			return fmt.Errorf("%s already owns %q", tx.From, tx.Name)
+		}
+		if tx.Blocks < 0 || tx.Blocks > MaxAcceptBlocks {
+			return fmt.Errorf("acceptance window must be 0 to %d blocks", MaxAcceptBlocks)
+		}
+		if tx.Blocks == 0 {
+			if err := r.setOwner(&entry, tx.To); err != nil {
+				return err
+			}
+		} else {
+			entry.PendingTransfer = &PendingTransfer{To: tx.To, ExpiresAt: height + tx.Blocks}
+		}
+
+	case TxAcceptName:
+		if !exists || entry.Status(height) != NameActive {
+			return fmt.Errorf("name %q is not registered", tx.Name)
+		}
+		pt := entry.PendingTransfer
+		if pt == nil || pt.To != tx.From {
+			return fmt.Errorf("no transfer of %q to %s", tx.Name, tx.From)
+		}
+		if height >= pt.ExpiresAt {
+			return fmt.Errorf("transfer of %q lapsed at block %d", tx.Name, pt.ExpiresAt)
+		}
+		if err := r.setOwner(&entry, tx.From); err != nil {
+			return err
+		}
+
+	case TxDelegate:
+		if entry, err = r.delegate(tx, entry, exists, height); err != nil {
+			return err
+		}
+
+	case TxRevoke:
+		return r.revoke(tx, entry, exists, height)
+
+	case TxRelease:
+		return r.release(tx, entry, exists, height)
+
+	case TxLock:
+		if err := lock(tx, &entry, exists, height); err != nil {
+			return err
+		}
+
+	case TxUnlock:
+		if err := unlock(tx, &entry, exists, height); err != nil {
+			return err
+		}
+
+	case TxBid:
+		return r.bid(tx, entry, exists, height)
+
+	case TxRevealBid:
+		return r.revealBid(tx, height)
+
+	case TxSettleAuction:
+		settled, won, err := r.settle(tx, height)
+		if err != nil || !won {
+			return err
+		}
+		entry = settled
+	}
+
+	// A primary name does not follow the name to its next owner
+	if exists && entry.Owner != prevOwner {
+		if err := r.clearPrimary(prevOwner, tx.Name); err != nil {
+			return err
+		}
+	}
+
+	entry.UpdatedAt = height
+	return r.state.put(nameKey(tx.Name), entry)
+}
+
+// checkOwner rejects tx unless its sender owns the name and the lease is
+// active at height.
+func checkOwner(entry NameEntry, exists bool, tx Transaction, height int) error {
+	if !exists || entry.Status(height) == NameExpired {
+		return fmt.Errorf("name %q is not registered", tx.Name)
+	}
+	if entry.Owner != tx.From {
+		return fmt.Errorf("%s does not own %q", tx.From, tx.Name)
+	}
+	if entry.Status(height) != NameActive {
+		return fmt.Errorf("name %q has expired", tx.Name)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	blockKeyPrefix  = "block-"
+	nameKeyPrefix   = "name-"
+	undoKeyPrefix   = "undo-"
+	stateHeightKey  = "state-height"
+	stateVersionKey = "state-version"
+)
+
+// stateVersion is bumped whenever the layout of the derived state changes,
+// so nodes rebuild it from their blocks on the next start.
+const stateVersion = 9
+
+func blockKey(index int) string {
+	return fmt.Sprintf("%s%09d", blockKeyPrefix, index)
+}
+
+func undoKey(index int) string {
+	return fmt.Sprintf("%s%09d", undoKeyPrefix, index)
+}
+
+func nameKey(name string) string {
+	return nameKeyPrefix + name
+}
+
+// undoRecord maps every state key a block touched to its value before the
+// block was applied. A nil value means the key did not exist.
+type undoRecord map[string][]byte
+
+// stateView buffers state writes on top of the database, or of another view,
+// so blocks and transactions can be checked before anything is persisted.
+type stateView struct {
+	db     *leveldb.DB
+	parent *stateView
+	writes map[string][]byte // nil marks a deleted key
+}
+
+func newStateView(db *leveldb.DB) *stateView {
+	return &stateView{db: db, writes: make(map[string][]byte)}
+}
+
+// child returns a view whose writes stay invisible to v until merged.
+func (v *stateView) child() *stateView {
+	return &stateView{db: v.db, parent: v, writes: make(map[string][]byte)}
+}
+
+func (v *stateView) getRaw(key string) ([]byte, error) {
+	if val, ok := v.writes[key]; ok {
+		return val, nil
+	}
+	if v.parent != nil {
+		return v.parent.getRaw(key)
+	}
+	val, err := v.db.Get([]byte(key), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	return val, err
+}
+
+func (v *stateView) putRaw(key string, val []byte) {
+	v.writes[key] = val
+}
+
+// get decodes the value stored under key into out and reports whether it exists.
+func (v *stateView) get(key string, out any) (bool, error) {
+	data, err := v.getRaw(key)
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, out)
+}
+
+func (v *stateView) put(key string, val any) error {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	v.putRaw(key, data)
+	return nil
+}
+
+func (v *stateView) delete(key string) {
+	v.writes[key] = nil
+}
+
+// undo returns the record that reverts the writes of v against its parent.
+func (v *stateView) undo() (undoRecord, error) {
+	record := make(undoRecord, len(v.writes))
+	for key := range v.writes {
+		prev, err := v.parent.getRaw(key)
+		if err != nil {
+			return nil, err
+		}
+		record[key] = prev
+	}
+	return record, nil
+}
+
+// merge folds the writes of a child view into its parent.
+func (v *stateView) merge() {
+	for key, val := range v.writes {
+		v.parent.writes[key] = val
+	}
+	v.writes = make(map[string][]byte)
+}
+
+// commit atomically writes a root view to the database.
+func (v *stateView) commit() error {
+	if v.parent != nil {
+		return errors.New("cannot commit a child view")
+	}
+	batch := new(leveldb.Batch)
+	for key, val := range v.writes {
+		if val == nil {
+			batch.Delete([]byte(key))
+		} else {
+			batch.Put([]byte(key), val)
+		}
+	}
+	if err := v.db.Write(batch, nil); err != nil {
+		return err
+	}
+	v.writes = make(map[string][]byte)
+	return nil
+}
+
+// revert restores the state touched by the block at index from its undo record.
+func (v *stateView) revert(index int) error {
+	var record undoRecord
+	found, err := v.get(undoKey(index), &record)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("missing undo data for block %d", index)
+	}
+	for key, prev := range record {
+		if prev == nil {
+			v.delete(key)
+		} else {
+			v.putRaw(key, prev)
+		}
+	}
+	v.delete(undoKey(index))
+	v.delete(blockKey(index))
+	return nil
+}
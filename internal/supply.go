@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"math"
+)
+
+// The monetary policy. Every block may mint a subsidy that starts at
+// InitialSubsidy and halves every HalvingInterval blocks, until MaxSupply
+// coins have been issued.
+const (
+	InitialSubsidy  = float64(100)
+	HalvingInterval = 105000
+	MaxSupply       = float64(21000000)
+)
+
+const supplyKey = "state-supply"
+
+// Supply is the coin accounting of the chain. Issued counts every coin
+// minted by a subsidy, Burned every coin paid to "nebula" or paid as a fee
+// no coinbase claimed. Circulating is what accounts other than "nebula"
+// hold: Issued less Burned. Height is the index of the next block, which
+// NextSubsidy applies to.
+type Supply struct {
+	Height      int     `json:"height"`
+	Circulating float64 `json:"circulating"`
+	Issued      float64 `json:"issued"`
+	Burned      float64 `json:"burned"`
+	Remaining   float64 `json:"remaining"`
+	MaxSupply   float64 `json:"max_supply"`
+	NextSubsidy float64 `json:"next_subsidy"`
+}
+
+// supplyCounters are the running totals kept in the state.
+type supplyCounters struct {
+	Issued float64 `json:"issued"`
+	Burned float64 `json:"burned"`
+}
+
+// Subsidy returns the scheduled subsidy of the block at height, before
+// the supply cap is applied.
+func Subsidy(height int) float64 {
+	halvings := height / HalvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+	return math.Ldexp(InitialSubsidy, -halvings)
+}
+
+// BlockSubsidy returns what the block at height may mint once issued
+// coins exist, which never takes the supply past MaxSupply.
+func BlockSubsidy(height int, issued float64) float64 {
+	return math.Max(0, math.Min(Subsidy(height), MaxSupply-issued))
+}
+
+func (v *stateView) supplyCounters() (supplyCounters, error) {
+	var c supplyCounters
+	_, err := v.get(supplyKey, &c)
+	return c, err
+}
+
+// burn counts amount as paid to "nebula".
+func (v *stateView) burn(amount float64) error {
+	c, err := v.supplyCounters()
+	if err != nil {
+		return err
+	}
+	c.Burned += amount
+	return v.put(supplyKey, c)
+}
+
+// issue counts the coins the coinbase of block minted beyond the fees it
+// collected, or burns the fees it left unclaimed.
+func (v *stateView) issue(block *Block) error {
+	minted := float64(0)
+	for _, tx := range block.Transactions {
+		if IsCoinbase(tx) {
+			minted += tx.Price
+		}
+	}
+	minted -= BlockFees(block.Transactions)
+	if minted == 0 {
+		return nil
+	}
+
+	c, err := v.supplyCounters()
+	if err != nil {
+		return err
+	}
+	if minted > 0 {
+		c.Issued += minted
+	} else {
+		c.Burned -= minted
+	}
+	return v.put(supplyKey, c)
+}
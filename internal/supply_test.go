@@ -0,0 +1,98 @@
+package internal
+
+import "testing"
+
+func TestSubsidyHalves(t *testing.T) {
+	tests := []struct {
+		height int
+		want   float64
+	}{
+		{1, InitialSubsidy},
+		{HalvingInterval - 1, InitialSubsidy},
+		{HalvingInterval, InitialSubsidy / 2},
+		{2*HalvingInterval - 1, InitialSubsidy / 2},
+		{2 * HalvingInterval, InitialSubsidy / 4},
+		{63 * HalvingInterval, InitialSubsidy / (1 << 63)},
+		{64 * HalvingInterval, 0},
+	}
+	for _, tt := range tests {
+		if got := Subsidy(tt.height); got != tt.want {
+			t.Errorf("Subsidy(%d) = %v, want %v", tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestBlockSubsidyStopsAtMaxSupply(t *testing.T) {
+	tests := []struct {
+		issued float64
+		want   float64
+	}{
+		{0, InitialSubsidy},
+		{MaxSupply - InitialSubsidy, InitialSubsidy},
+		{MaxSupply - 30, 30},
+		{MaxSupply, 0},
+		{MaxSupply + 1, 0},
+	}
+	for _, tt := range tests {
+		if got := BlockSubsidy(1, tt.issued); got != tt.want {
+			t.Errorf("BlockSubsidy(1, %v) = %v, want %v", tt.issued, got, tt.want)
+		}
+	}
+}
+
+func TestIssueCountsMintedAndUnclaimedFees(t *testing.T) {
+	const miner = "1879fc84e4469a624a82f8d786f5dfef9b65a712"
+	view := newStateView(newTestChain(t).db)
+	start, err := view.supplyCounters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := func(reward float64, fees ...float64) *Block {
+		txs := []Transaction{{Type: TxTransfer, From: "nebula", To: miner, Price: reward}}
+		for _, fee := range fees {
+			txs = append(txs, Transaction{Type: TxTransfer, From: miner, To: miner, Fee: fee})
+		}
+		return &Block{Transactions: txs}
+	}
+	tests := []struct {
+		name           string
+		block          *Block
+		issued, burned float64
+	}{
+		{"subsidy and fees", block(InitialSubsidy+3, 1, 2), InitialSubsidy, 0},
+		{"fees only", block(3, 1, 2), 0, 0},
+		{"unclaimed fees", block(1, 1, 2), 0, 2},
+		{"no coinbase claim", block(0, 4), 0, 4},
+	}
+	for _, tt := range tests {
+		before, err := view.supplyCounters()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := view.issue(tt.block); err != nil {
+			t.Fatal(err)
+		}
+		after, err := view.supplyCounters()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := after.Issued - before.Issued; got != tt.issued {
+			t.Errorf("%s: issued %v, want %v", tt.name, got, tt.issued)
+		}
+		if got := after.Burned - before.Burned; got != tt.burned {
+			t.Errorf("%s: burned %v, want %v", tt.name, got, tt.burned)
+		}
+	}
+
+	if err := view.credit("nebula", 5); err != nil {
+		t.Fatal(err)
+	}
+	end, err := view.supplyCounters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := end.Burned - start.Burned; got != 11 {
+		t.Errorf("burned %v in total, want 11", got)
+	}
+}
@@ -12,17 +12,68 @@ const (
 	TxSetIP    = "SET_IP"
 	TxSell     = "SELL"
 	TxBuy      = "BUY"
+
+	TxSetRecords = "SET_RECORDS"
+	TxRenew      = "RENEW"
+
+	TxCancelListing = "CANCEL_LISTING"
+	TxCommit        = "COMMIT"
+	TxBid           = "BID"
+	TxRevealBid     = "REVEAL_BID"
+	TxSettleAuction = "SETTLE_AUCTION"
+	TxTransferName  = "TRANSFER_NAME"
+	TxAcceptName    = "ACCEPT_NAME"
+	TxDelegate      = "DELEGATE"
+	TxRevoke        = "REVOKE"
+	TxSetPrimary    = "SET_PRIMARY"
+	TxOffer         = "OFFER"
+	TxAcceptOffer   = "ACCEPT_OFFER"
+	TxRelease       = "RELEASE"
+	TxLock          = "LOCK"
+	TxUnlock        = "UNLOCK"
 )
 
+// nameTxTypes are the tx types that operate on the name they carry, and
+// so the ones recorded in its history.
+var nameTxTypes = map[string]bool{
+	TxRegister: true, TxRenew: true, TxSetIP: true, TxSetRecords: true,
+	TxSell: true, TxCancelListing: true, TxBuy: true,
+	TxBid: true, TxRevealBid: true, TxSettleAuction: true,
+	TxTransferName: true, TxAcceptName: true, TxDelegate: true, TxRevoke: true,
+	TxOffer: true, TxAcceptOffer: true, TxRelease: true, TxLock: true, TxUnlock: true,
+}
+
 type Transaction struct {
-	Type      string            `json:"type"`
-	From      string            `json:"from"`
-	To        string            `json:"to"`
-	Name      string            `json:"name"`
-	Price     float64           `json:"price"`
-	Fee       float64           `json:"fee"`
-	Payload   map[string]string `json:"payload"`
-	Signature string            `json:"signature"`
+	ChainID    string            `json:"chain_id"`
+	Type       string            `json:"type"`
+	From       string            `json:"from"`
+	Nonce      uint64            `json:"nonce"`
+	To         string            `json:"to"`
+	Name       string            `json:"name"`
+	Price      float64           `json:"price"`
+	Fee        float64           `json:"fee"`
+	Payload    map[string]string `json:"payload"`
+	Records    []Record          `json:"records,omitempty"`
+	ExpiresAt  int               `json:"expires_at,omitempty"`
+	Commitment string            `json:"commitment,omitempty"`
+	Salt       string            `json:"salt,omitempty"`
+	Blocks     int               `json:"blocks,omitempty"`
+	Revocable  bool              `json:"revocable,omitempty"`
+	Signature  string            `json:"signature"`
+}
+
+// Amount returns the value tx moves from its sender. A SELL only names an
+// asking price and a REVEAL_BID only opens a bid, so they move nothing.
+func (tx *Transaction) Amount() float64 {
+	if tx.Type == TxSell || tx.Type == TxRevealBid {
+		return 0
+	}
+	return tx.Price
+}
+
+// Cost returns what the sender of tx pays: the value it moves plus the fee.
+func (tx *Transaction) Cost() float64 {
+	return tx.Amount() + tx.Fee
 }
 
 func (tx *Transaction) Hash() string {
@@ -39,6 +39,12 @@ func PubKeyToAddress(pub *btcec.PublicKey) string {
 	return hex.EncodeToString(pubKeyHash)
 }
 
+// IsAddress reports whether s is a well-formed hex HASH160 address
+func IsAddress(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == ripemd160.Size && s == hex.EncodeToString(b)
+}
+
 // SaveWallet saves the raw private key bytes as hex to a file (0600)
 func SaveWallet(w *Wallet, filename string) error {
 	privBytes := w.PrivateKey.Serialize() // 32 bytes
@@ -0,0 +1,395 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ZoneOrigin returns the fully qualified origin of zone, e.g. "nebula."
+// for ".nebula".
+func ZoneOrigin(zone string) string {
+	zone = strings.ToLower(strings.Trim(zone, "."))
+	if zone == "" {
+		zone = "nebula"
+	}
+	return zone + "."
+}
+
+// WriteZone writes entries as an RFC 1035 master file for origin. The SOA
+// serial is the chain height the entries were read at.
+func WriteZone(w io.Writer, origin string, serial int, entries []NameEntry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s\n", origin)
+	fmt.Fprintf(bw, "$TTL %d\n", DefaultDNSTTL)
+	fmt.Fprintf(bw, "@\tIN\tSOA\tns1.%s hostmaster.%s %d 3600 600 604800 %d\n", origin, origin, serial, DefaultDNSTTL)
+	fmt.Fprintf(bw, "@\tIN\tNS\tns1.%s\n", origin)
+
+	for _, entry := range entries {
+		for _, r := range entry.Records {
+			fmt.Fprintf(bw, "%s\t%d\tIN\t%s\t%s\n", entry.Name, r.TTL, r.Type, zoneData(r))
+		}
+	}
+	return bw.Flush()
+}
+
+// zoneData returns the RDATA of r in master file format.
+func zoneData(r Record) string {
+	switch r.Type {
+	case RecordTXT:
+		return quoteTXT(r.Value)
+	case RecordCNAME:
+		return fqdn(r.Value)
+	case RecordMX:
+		return fmt.Sprintf("%d %s", r.Priority, fqdn(r.Value))
+	case RecordSRV:
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, fqdn(r.Value))
+	}
+	return r.Value
+}
+
+func quoteTXT(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// ParseZone reads an RFC 1035 master file for origin and returns the
+// records it holds for each name under origin. Records of the zone apex,
+// such as its SOA and NS, are skipped.
+func ParseZone(r io.Reader, origin string) (map[string][]Record, error) {
+	origin = ZoneOrigin(origin)
+	p := zoneParser{zone: origin, origin: origin, ttl: DefaultDNSTTL}
+	names := map[string][]Record{}
+
+	lines, err := zoneLines(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		name, rec, ok, err := p.parse(l)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.num, err)
+		}
+		if !ok {
+			continue
+		}
+		names[name] = append(names[name], rec)
+	}
+	return names, nil
+}
+
+// zoneLine is one entry of a master file, with parentheses joined and
+// comments removed.
+type zoneLine struct {
+	num    int
+	tokens []string
+	// continued is set when the line starts with whitespace, which
+	// repeats the previous owner.
+	continued bool
+}
+
+type zoneParser struct {
+	zone   string
+	origin string
+	owner  string
+	ttl    uint32
+}
+
+// zoneLines splits a master file into entries.
+func zoneLines(r io.Reader) ([]zoneLine, error) {
+	var (
+		lines  []zoneLine
+		cur    zoneLine
+		depth  int
+		num    int
+		reader = bufio.NewScanner(r)
+	)
+	for reader.Scan() {
+		num++
+		text := reader.Text()
+		if depth == 0 {
+			cur = zoneLine{num: num, continued: text != "" && (text[0] == ' ' || text[0] == '\t')}
+		}
+
+		tokens, opened, err := zoneTokens(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", num, err)
+		}
+		depth += opened
+		if depth < 0 {
+			return nil, fmt.Errorf("line %d: unbalanced parentheses", num)
+		}
+		cur.tokens = append(cur.tokens, tokens...)
+		if depth == 0 && len(cur.tokens) > 0 {
+			lines = append(lines, cur)
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("unbalanced parentheses at end of file")
+	}
+	return lines, reader.Err()
+}
+
+// zoneTokens splits a line into tokens, dropping comments and reporting
+// the net number of parentheses it opens. Quoted strings keep their quotes.
+func zoneTokens(line string) ([]string, int, error) {
+	var (
+		tokens []string
+		opened int
+	)
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ';':
+			return tokens, opened, nil
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '(':
+			opened++
+			i++
+		case c == ')':
+			opened--
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(line) && line[j] != '"' {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(line) {
+				return nil, 0, errors.New("unterminated string")
+			}
+			tokens = append(tokens, line[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(line) && !strings.ContainsRune(" \t\r;()\"", rune(line[j])) {
+				j++
+			}
+			tokens = append(tokens, line[i:j])
+			i = j
+		}
+	}
+	return tokens, opened, nil
+}
+
+// parse handles a directive or a resource record. It reports ok for a
+// record under the zone, along with the name it belongs to.
+func (p *zoneParser) parse(l zoneLine) (string, Record, bool, error) {
+	tokens := l.tokens
+	switch strings.ToUpper(tokens[0]) {
+	case "$ORIGIN":
+		if len(tokens) != 2 {
+			return "", Record{}, false, errors.New("$ORIGIN takes one name")
+		}
+		p.origin = strings.ToLower(p.absolute(tokens[1]))
+		return "", Record{}, false, nil
+	case "$TTL":
+		if len(tokens) != 2 {
+			return "", Record{}, false, errors.New("$TTL takes one value")
+		}
+		ttl, err := parseTTL(tokens[1])
+		if err != nil {
+			return "", Record{}, false, err
+		}
+		p.ttl = ttl
+		return "", Record{}, false, nil
+	case "$INCLUDE", "$GENERATE":
+		return "", Record{}, false, fmt.Errorf("%s is not supported", tokens[0])
+	}
+
+	if !l.continued {
+		p.owner = strings.ToLower(p.absolute(tokens[0]))
+		tokens = tokens[1:]
+	}
+	if p.owner == "" {
+		return "", Record{}, false, errors.New("record has no owner")
+	}
+
+	ttl := p.ttl
+	for len(tokens) > 0 {
+		if t, err := parseTTL(tokens[0]); err == nil {
+			ttl = t
+		} else if !strings.EqualFold(tokens[0], "IN") {
+			break
+		}
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return "", Record{}, false, errors.New("record has no type")
+	}
+	rtype, data := strings.ToUpper(tokens[0]), tokens[1:]
+
+	if p.owner == p.zone {
+		// The apex is not a name in the registry
+		return "", Record{}, false, nil
+	}
+	name, ok := strings.CutSuffix(p.owner, "."+p.zone)
+	if !ok {
+		return "", Record{}, false, fmt.Errorf("%s is not under %s", p.owner, p.zone)
+	}
+
+	rec, err := p.record(rtype, data)
+	if err != nil {
+		return "", Record{}, false, err
+	}
+	rec.TTL = ttl
+	return name, rec, true, nil
+}
+
+// record parses the RDATA of a record of type rtype.
+func (p *zoneParser) record(rtype string, data []string) (Record, error) {
+	want := map[string]int{
+		RecordA: 1, RecordAAAA: 1, RecordCNAME: 1, RecordMX: 2, RecordSRV: 4,
+	}
+	if n, ok := want[rtype]; ok && len(data) != n {
+		return Record{}, fmt.Errorf("%s record takes %d fields", rtype, n)
+	}
+
+	rec := Record{Type: rtype}
+	switch rtype {
+	case RecordA, RecordAAAA:
+		rec.Value = data[0]
+	case RecordCNAME:
+		rec.Value = p.target(data[0])
+	case RecordMX:
+		pref, err := strconv.ParseUint(data[0], 10, 16)
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid MX preference %q", data[0])
+		}
+		rec.Priority, rec.Value = uint16(pref), p.target(data[1])
+	case RecordSRV:
+		var fields [3]uint16
+		for i := range fields {
+			n, err := strconv.ParseUint(data[i], 10, 16)
+			if err != nil {
+				return Record{}, fmt.Errorf("invalid SRV field %q", data[i])
+			}
+			fields[i] = uint16(n)
+		}
+		rec.Priority, rec.Weight, rec.Port = fields[0], fields[1], fields[2]
+		rec.Value = p.target(data[3])
+	case RecordTXT:
+		if len(data) == 0 {
+			return Record{}, errors.New("TXT record has no strings")
+		}
+		var b strings.Builder
+		for _, s := range data {
+			text, err := unquoteTXT(s)
+			if err != nil {
+				return Record{}, err
+			}
+			b.WriteString(text)
+		}
+		rec.Value = b.String()
+	default:
+		return Record{}, fmt.Errorf("unsupported record type %q", rtype)
+	}
+	return rec, nil
+}
+
+// absolute qualifies a domain name against the current origin.
+func (p *zoneParser) absolute(name string) string {
+	switch {
+	case name == "@":
+		return p.origin
+	case strings.HasSuffix(name, "."):
+		return name
+	}
+	return name + "." + p.origin
+}
+
+// target returns a record target as a hostname without the final dot.
+func (p *zoneParser) target(name string) string {
+	return strings.TrimSuffix(p.absolute(name), ".")
+}
+
+func unquoteTXT(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s, nil
+	}
+	s = s[1 : len(s)-1]
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return "", errors.New("dangling escape in TXT string")
+		}
+		if i+2 < len(s) && isDigits(s[i:i+3]) {
+			n, _ := strconv.Atoi(s[i : i+3])
+			if n > 255 {
+				return "", fmt.Errorf("invalid escape \\%s", s[i:i+3])
+			}
+			b.WriteByte(byte(n))
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// parseTTL parses a TTL in seconds, optionally written with s, m, h, d or
+// w units as BIND allows, e.g. "1h30m".
+func parseTTL(s string) (uint32, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(n), nil
+	}
+
+	units := map[byte]uint64{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	var total, n uint64
+	digits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			n = n*10 + uint64(s[i]-'0')
+			digits = true
+		case units[c] != 0 && digits:
+			total += n * units[c]
+			n, digits = 0, false
+		default:
+			return 0, fmt.Errorf("invalid ttl %q", s)
+		}
+		if total+n > 1<<32-1 {
+			return 0, fmt.Errorf("ttl %q out of range", s)
+		}
+	}
+	if digits || total == 0 {
+		return 0, fmt.Errorf("invalid ttl %q", s)
+	}
+	return uint32(total), nil
+}
@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseZone(t *testing.T) {
+	tests := []struct {
+		name string
+		zone string
+		want map[string][]Record
+	}{
+		{
+			name: "relative and absolute owners",
+			zone: "example IN A 192.0.2.1\nother.nebula. 60 IN AAAA 2001:db8::1\n",
+			want: map[string][]Record{
+				"example": {{Type: RecordA, Value: "192.0.2.1", TTL: DefaultDNSTTL}},
+				"other":   {{Type: RecordAAAA, Value: "2001:db8::1", TTL: 60}},
+			},
+		},
+		{
+			name: "origin and ttl directives",
+			zone: "$TTL 120\n$ORIGIN sub.nebula.\nwww A 192.0.2.2\n$ORIGIN nebula.\n@ NS ns1\nmail 30 MX 10 mx\n",
+			want: map[string][]Record{
+				"www.sub": {{Type: RecordA, Value: "192.0.2.2", TTL: 120}},
+				"mail":    {{Type: RecordMX, Value: "mx.nebula", Priority: 10, TTL: 30}},
+			},
+		},
+		{
+			name: "continued owner",
+			zone: "example A 192.0.2.1\n\tTXT \"hello\"\n  IN 60 CNAME alias.example.com.\n",
+			want: map[string][]Record{
+				"example": {
+					{Type: RecordA, Value: "192.0.2.1", TTL: DefaultDNSTTL},
+					{Type: RecordTXT, Value: "hello", TTL: DefaultDNSTTL},
+					{Type: RecordCNAME, Value: "alias.example.com", TTL: 60},
+				},
+			},
+		},
+		{
+			name: "parentheses and comments",
+			zone: "; a comment\n@ IN SOA ns1 host ( 1 ; serial\n  3600 600\n  604800 300 )\n" +
+				"svc IN SRV ( 1 2 ; priority, weight\n 443 target ) ; trailing\n",
+			want: map[string][]Record{
+				"svc": {{Type: RecordSRV, Value: "target.nebula", Priority: 1, Weight: 2, Port: 443, TTL: DefaultDNSTTL}},
+			},
+		},
+		{
+			name: "txt escapes",
+			zone: `txt TXT "say \"hi\"" " \\ and \059 \255" unquoted` + "\n",
+			want: map[string][]Record{
+				"txt": {{Type: RecordTXT, Value: "say \"hi\" \\ and ; \xffunquoted", TTL: DefaultDNSTTL}},
+			},
+		},
+		{
+			name: "bind ttl units",
+			zone: "$TTL 1h30m\na A 192.0.2.1\nb 2d A 192.0.2.2\nc 1W A 192.0.2.3\n",
+			want: map[string][]Record{
+				"a": {{Type: RecordA, Value: "192.0.2.1", TTL: 5400}},
+				"b": {{Type: RecordA, Value: "192.0.2.2", TTL: 172800}},
+				"c": {{Type: RecordA, Value: "192.0.2.3", TTL: 604800}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseZone(strings.NewReader(tt.zone), "nebula")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseZoneErrors(t *testing.T) {
+	tests := map[string]string{
+		"unbalanced open":     "a A ( 192.0.2.1\n",
+		"unbalanced close":    "a A 192.0.2.1 )\n",
+		"unterminated string": "a TXT \"open\n",
+		"outside the zone":    "a.example.com. A 192.0.2.1\n",
+		"no owner":            "  A 192.0.2.1\n",
+		"no type":             "a 60 IN\n",
+		"unsupported type":    "a PTR host\n",
+		"wrong field count":   "a MX mail\n",
+		"bad mx preference":   "a MX high mail\n",
+		"include":             "$INCLUDE other.zone\n",
+		"bad ttl directive":   "$TTL soon\n",
+		"escape out of range": "a TXT \"\\256\"\n",
+	}
+	for name, zone := range tests {
+		if _, err := ParseZone(strings.NewReader(zone), "nebula"); err == nil {
+			t.Errorf("%s: parsed %q", name, zone)
+		}
+	}
+}
+
+func TestUnquoteTXT(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{`plain`, "plain", true},
+		{`""`, "", true},
+		{`"a b"`, "a b", true},
+		{`"\"x\""`, `"x"`, true},
+		{`"back\\slash"`, `back\slash`, true},
+		{`"\065\066"`, "AB", true},
+		{`"\000"`, "\x00", true},
+		{`"\12"`, "12", true},
+		{`"\256"`, "", false},
+		{`"dangling\"`, "", false},
+	}
+	for _, tt := range tests {
+		got, err := unquoteTXT(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("unquoteTXT(%s) = %q, %v; want %q, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint32
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"300", 300, true},
+		{"30s", 30, true},
+		{"5m", 300, true},
+		{"1h30m", 5400, true},
+		{"1D", 86400, true},
+		{"2w1d", 1296000, true},
+		{"4294967295", 4294967295, true},
+		{"4294967296", 0, false},
+		{"7102w", 0, false},
+		{"1h30", 0, false},
+		{"h", 0, false},
+		{"1x", 0, false},
+		{"", 0, false},
+		{"IN", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseTTL(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseTTL(%q) = %d, %v; want %d, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestZoneRoundTrip(t *testing.T) {
+	entries := []NameEntry{
+		{Name: "example", Records: []Record{
+			{Type: RecordA, Value: "192.0.2.1", TTL: 60},
+			{Type: RecordAAAA, Value: "2001:db8::1", TTL: 60},
+			{Type: RecordMX, Value: "mail.example.com", Priority: 10, TTL: 3600},
+			{Type: RecordTXT, Value: "v=spf1 \"quoted\" \\ ; tab\there \x01\xff", TTL: 300},
+		}},
+		{Name: "www.example", Records: []Record{
+			{Type: RecordCNAME, Value: "example.nebula", TTL: 300},
+		}},
+		{Name: "svc", Records: []Record{
+			{Type: RecordSRV, Value: "host.example.com", Priority: 1, Weight: 5, Port: 8443, TTL: 120},
+		}},
+		{Name: "empty", Records: []Record{}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteZone(&buf, ZoneOrigin("nebula"), 42, entries); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseZone(&buf, "nebula")
+	if err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+
+	want := map[string][]Record{}
+	for _, e := range entries {
+		if len(e.Records) > 0 {
+			want[e.Name] = e.Records
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip:\ngot  %+v\nwant %+v", got, want)
+	}
+}